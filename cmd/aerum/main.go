@@ -42,6 +42,7 @@ import (
 	"github.com/AERUMTechnology/go-aerum/log"
 	"github.com/AERUMTechnology/go-aerum/metrics"
 	"github.com/AERUMTechnology/go-aerum/node"
+	"github.com/AERUMTechnology/go-aerum/params"
 	cli "gopkg.in/urfave/cli.v1"
 )
 
@@ -252,6 +253,11 @@ func init() {
 		if err := debug.Setup(ctx, logdir); err != nil {
 			return err
 		}
+		// Added by Aerum
+		// Refuse to run on the built-in network parameters if the overrides are invalid
+		if err := params.AtmosParamsEnvError(); err != nil {
+			return err
+		}
 		// If we're a full node on mainnet without --cache specified, bump default cache allowance
 		if ctx.GlobalString(utils.SyncModeFlag.Name) != "light" && !ctx.GlobalIsSet(utils.CacheFlag.Name) && !ctx.GlobalIsSet(utils.NetworkIdFlag.Name) {
 			// Make sure we're not on any supported preconfigured testnet either
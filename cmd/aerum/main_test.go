@@ -0,0 +1,48 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+// Tests that the node refuses to start if the Atmos network parameters are
+// overridden with invalid values, instead of falling back to the built-in ones.
+func TestInvalidAtmosEnvironment(t *testing.T) {
+	prev, ok := os.LookupEnv("AERUM_NET_ID")
+	os.Setenv("AERUM_NET_ID", "bogus")
+	defer func() {
+		if ok {
+			os.Setenv("AERUM_NET_ID", prev)
+		} else {
+			os.Unsetenv("AERUM_NET_ID")
+		}
+	}()
+	geth := runGeth(t, "version")
+	defer geth.Cleanup()
+	geth.WaitExit()
+
+	if status := geth.ExitStatus(); status == 0 {
+		t.Errorf("invalid environment accepted")
+	}
+	if stderr := geth.StderrText(); !strings.Contains(stderr, "AERUM_NET_ID") {
+		t.Errorf("error doesn't name the invalid override: %q", stderr)
+	}
+}
@@ -487,3 +487,69 @@ func newPyEthereumGenesisSpec(network string, genesis *core.Genesis) (*pyEthereu
 
 	return spec, nil
 }
+
+// aerumGenesisSpec represents the Aerum native genesis specification format,
+// carrying the full Atmos consensus configuration for third party tooling.
+type aerumGenesisSpec struct {
+	Name       string              `json:"name"`
+	SealEngine string              `json:"sealEngine"`
+	Atmos      *params.AtmosConfig `json:"atmos"`
+
+	Params struct {
+		NetworkID           hexutil.Uint64 `json:"networkID"`
+		ChainID             hexutil.Uint64 `json:"chainID"`
+		HomesteadBlock      *hexutil.Big   `json:"homesteadBlock,omitempty"`
+		EIP150Block         *hexutil.Big   `json:"eip150Block,omitempty"`
+		EIP155Block         *hexutil.Big   `json:"eip155Block,omitempty"`
+		EIP158Block         *hexutil.Big   `json:"eip158Block,omitempty"`
+		ByzantiumBlock      *hexutil.Big   `json:"byzantiumBlock,omitempty"`
+		ConstantinopleBlock *hexutil.Big   `json:"constantinopleBlock,omitempty"`
+		PetersburgBlock     *hexutil.Big   `json:"petersburgBlock,omitempty"`
+	} `json:"params"`
+
+	Genesis struct {
+		Timestamp  hexutil.Uint64 `json:"timestamp"`
+		ExtraData  hexutil.Bytes  `json:"extraData"`
+		GasLimit   hexutil.Uint64 `json:"gasLimit"`
+		Difficulty *hexutil.Big   `json:"difficulty"`
+		Coinbase   common.Address `json:"coinbase"`
+		ParentHash common.Hash    `json:"parentHash"`
+	} `json:"genesis"`
+
+	Accounts core.GenesisAlloc `json:"accounts"`
+}
+
+// newAerumGenesisSpec converts a go-aerum genesis block into the Aerum native
+// chain specification format.
+func newAerumGenesisSpec(network string, genesis *core.Genesis) (*aerumGenesisSpec, error) {
+	// Only atmos carries the Aerum specific consensus configuration
+	if genesis.Config.Atmos == nil {
+		return nil, errors.New("unsupported consensus engine")
+	}
+	spec := &aerumGenesisSpec{
+		Name:       network,
+		SealEngine: "Atmos",
+		Atmos:      genesis.Config.Atmos,
+		Accounts:   genesis.Alloc,
+	}
+	if genesis.Config.ChainID != nil {
+		spec.Params.NetworkID = (hexutil.Uint64)(genesis.Config.ChainID.Uint64())
+		spec.Params.ChainID = (hexutil.Uint64)(genesis.Config.ChainID.Uint64())
+	}
+	spec.Params.HomesteadBlock = (*hexutil.Big)(genesis.Config.HomesteadBlock)
+	spec.Params.EIP150Block = (*hexutil.Big)(genesis.Config.EIP150Block)
+	spec.Params.EIP155Block = (*hexutil.Big)(genesis.Config.EIP155Block)
+	spec.Params.EIP158Block = (*hexutil.Big)(genesis.Config.EIP158Block)
+	spec.Params.ByzantiumBlock = (*hexutil.Big)(genesis.Config.ByzantiumBlock)
+	spec.Params.ConstantinopleBlock = (*hexutil.Big)(genesis.Config.ConstantinopleBlock)
+	spec.Params.PetersburgBlock = (*hexutil.Big)(genesis.Config.PetersburgBlock)
+
+	spec.Genesis.Timestamp = (hexutil.Uint64)(genesis.Timestamp)
+	spec.Genesis.ExtraData = genesis.ExtraData
+	spec.Genesis.GasLimit = (hexutil.Uint64)(genesis.GasLimit)
+	spec.Genesis.Difficulty = (*hexutil.Big)(genesis.Difficulty)
+	spec.Genesis.Coinbase = genesis.Coinbase
+	spec.Genesis.ParentHash = genesis.ParentHash
+
+	return spec, nil
+}
@@ -32,6 +32,7 @@ import (
 	"sync"
 
 	"github.com/AERUMTechnology/go-aerum/common"
+	"github.com/AERUMTechnology/go-aerum/consensus/atmos"
 	"github.com/AERUMTechnology/go-aerum/core"
 	"github.com/AERUMTechnology/go-aerum/log"
 	"golang.org/x/crypto/ssh/terminal"
@@ -76,6 +77,8 @@ type wizard struct {
 	servers  map[string]*sshClient // SSH connections to servers to administer
 	services map[string][]string   // Ethereum services known to be running on servers
 
+	composers atmos.ComposerSource // Source of the bootstrap delegates (nil = governance contract)
+
 	in   *bufio.Reader // Wrapper around stdin to allow reading user input
 	lock sync.Mutex    // Lock to protect configs during concurrent service discovery
 }
@@ -299,8 +302,11 @@ func (w *wizard) readAddress() *common.Address {
 			log.Error("Invalid address length, please retry")
 			continue
 		}
-		bigaddr, _ := new(big.Int).SetString(text, 16)
-		address := common.BigToAddress(bigaddr)
+		if !common.IsHexAddress(text) {
+			log.Error("Invalid address, expected hex characters, please retry")
+			continue
+		}
+		address := common.HexToAddress(text)
 		return &address
 	}
 }
@@ -324,8 +330,11 @@ func (w *wizard) readDefaultAddress(def common.Address) common.Address {
 			log.Error("Invalid address length, please retry")
 			continue
 		}
-		bigaddr, _ := new(big.Int).SetString(text, 16)
-		return common.BigToAddress(bigaddr)
+		if !common.IsHexAddress(text) {
+			log.Error("Invalid address, expected hex characters, please retry")
+			continue
+		}
+		return common.HexToAddress(text)
 	}
 }
 
@@ -17,60 +17,70 @@
 package main
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"math"
 	"math/big"
 	"net/http"
 	"os"
 	"path/filepath"
 	"time"
 
-	"github.com/AERUMTechnology/go-aerum/accounts/abi/bind"
 	"github.com/AERUMTechnology/go-aerum/common"
-	guvnor "github.com/AERUMTechnology/go-aerum/contracts/atmosGovernance"
+	"github.com/AERUMTechnology/go-aerum/consensus/atmos"
 	"github.com/AERUMTechnology/go-aerum/core"
-	"github.com/AERUMTechnology/go-aerum/ethclient"
 	"github.com/AERUMTechnology/go-aerum/log"
 	"github.com/AERUMTechnology/go-aerum/params"
 )
 
-func getBootstrapDelegates() ([]common.Address, error) {
+// getBootstrapDelegates retrieves the signers to embed into a new genesis block,
+// failing if the composer source can't provide enough of them to seal blocks.
+func getBootstrapDelegates(source atmos.ComposerSource) ([]common.Address, error) {
 	fmt.Println("\n\n[aerDEV] --------------------------------------------------------------------------------------------------------- [aerDEV]")
 	fmt.Println("[aerDEV] --- We are calling our Governance Contract on Ethereum to add our bootstrap signers to this genesis --- [aerDEV]")
-	fmt.Println("[aerDEV] --------------------------------------------------------------------------------------------------------- [aerDEV]\n\n")
-	bootstrapDelegates := make([]common.Address, 0)
-	ethclient, err := ethclient.Dial( params.NewAtmosEthereumRPCProvider() )
-	if err != nil {
-		fmt.Println(err)
-	}
-	caller, err := guvnor.NewAtmosCaller( params.NewAtmosGovernanceAddress(), ethclient)
-	if err != nil {
-		fmt.Println(err)
-	}
-	addresses, err := caller.GetComposers(&bind.CallOpts{}, big.NewInt(0), big.NewInt(time.Now().Unix()))
+	fmt.Println("[aerDEV] --------------------------------------------------------------------------------------------------------- [aerDEV]")
+	fmt.Println()
+
+	addresses, err := source.Composers(context.Background(), 0, big.NewInt(time.Now().Unix()))
 	if err != nil {
-		fmt.Println(err)
+		return nil, err
 	}
 	if len(addresses) < params.NewAtmosMinDelegateNo() {
-		log.Error("Failed to save genesis file", "err",  fmt.Sprintf("Not enough Delegates to continue. Only %d found - Contact the aerum team to report this issue.", len(addresses) ) )
-	}
-	if len(addresses) >= params.NewAtmosMinDelegateNo() {
-		log.Info(fmt.Sprintf("Fantastic! we found %d delegates. you may proceed in generating a genesis.", len(addresses)))
+		return nil, fmt.Errorf("not enough delegates to continue: only %d found, %d required - contact the aerum team to report this issue", len(addresses), params.NewAtmosMinDelegateNo())
 	}
-	for _, address := range addresses {
-		bootstrapDelegates = append(bootstrapDelegates, address)
+	log.Info(fmt.Sprintf("Fantastic! we found %d delegates. you may proceed in generating a genesis.", len(addresses)))
+
+	return addresses, nil
+}
+
+// bootstrapSource returns the composer source to retrieve the bootstrap delegates
+// from, querying the given governance contract through the given endpoint unless
+// overridden.
+func (w *wizard) bootstrapSource(endpoint string, governance common.Address) atmos.ComposerSource {
+	if w.composers != nil {
+		return w.composers
 	}
-	return bootstrapDelegates, nil
+	return atmos.NewGovernanceSource(endpoint, governance)
 }
 
 // makeGenesis creates a new genesis struct based on some user input.
 func (w *wizard) makeGenesis() {
-	boostrapDelegate, err := getBootstrapDelegates()
+	// Figure out which governance deployment to bootstrap the signers from
+	fmt.Println()
+	fmt.Printf("Which governance contract should select the signers? (default = %s)\n", params.NewAtmosGovernanceAddress().Hex())
+	governance := w.readDefaultAddress(params.NewAtmosGovernanceAddress())
+
+	fmt.Println()
+	fmt.Printf("Which Ethereum RPC endpoint should governance be queried through? (default = %s)\n", params.NewAtmosEthereumRPCProvider())
+	endpoint := w.readDefaultString(params.NewAtmosEthereumRPCProvider())
+
+	boostrapDelegate, err := getBootstrapDelegates(w.bootstrapSource(endpoint, governance))
 	if err != nil {
-		log.Error("Failed to save genesis file", "err",  fmt.Sprintf("There was a problem getting our bootstrap delegates. Please report this error %s.", err ) )
+		log.Error("Failed to retrieve bootstrap delegates, genesis not created", "err", err)
+		return
 	}
 
 	// Construct a default genesis block
@@ -88,10 +98,10 @@ func (w *wizard) makeGenesis() {
 			ConstantinopleBlock: big.NewInt(0),
 			PetersburgBlock:     big.NewInt(0),
 			Atmos: &params.AtmosConfig{
-				Period:                     params.NewAtmosBlockInterval(),
-				Epoch:                      params.NewAtmosEpochInterval(),
-				GovernanceAddress:          params.NewAtmosGovernanceAddress(),
-				EthereumApiEndpoint: params.NewAtmosEthereumRPCProvider(),
+				Period:              params.NewAtmosBlockInterval(),
+				Epoch:               params.NewAtmosEpochInterval(),
+				GovernanceAddress:   governance,
+				EthereumApiEndpoint: endpoint,
 			},
 		},
 	}
@@ -103,44 +113,54 @@ func (w *wizard) makeGenesis() {
 	choice := w.read()
 	switch {
 	case len(choice) < 1 || choice == "1":
-		genesis.Config.ChainID = new(big.Int).SetUint64(uint64( params.NewAtmosNetID() ))
-		var signers []common.Address
-		for _, signer := range boostrapDelegate {
-			signers = append(signers, signer)
-		}
+		genesis.Config.ChainID = new(big.Int).SetUint64(uint64(params.NewAtmosNetID()))
 		// Sort the signers and embed into the extra-data section
-		for i := 0; i < len(signers); i++ {
-			for j := i + 1; j < len(signers); j++ {
-				if bytes.Compare(signers[i][:], signers[j][:]) > 0 {
-					signers[i], signers[j] = signers[j], signers[i]
-				}
-			}
-		}
-		genesis.ExtraData = make([]byte, 32+len(signers)*common.AddressLength+65)
-		for i, signer := range signers {
-			copy(genesis.ExtraData[32+i*common.AddressLength:], signer[:])
-		}
+		genesis.ExtraData = atmos.MakeExtraData(boostrapDelegate)
 
 	default:
 		log.Crit("Invalid consensus engine choice", "choice", choice)
 	}
-	// Consensus all set, just ask for initial funds and go
+	// Query the user for the gas limit, rejecting anything the protocol can't extend
 	fmt.Println()
-	fmt.Println("Which accounts should be pre-funded? (advisable at least one)")
+	fmt.Printf("What should the genesis gas limit be? (default = %d)\n", genesis.GasLimit)
 	for {
-		// Read the address of the account to fund
-		if address := w.readAddress(); address != nil {
-			genesis.Alloc[*address] = core.GenesisAccount{
-				Balance: new(big.Int).Lsh(big.NewInt(1), 256-7), // 2^256 / 128 (allow many pre-funds without balance overflows)
-			}
+		limit := w.readDefaultBigInt(new(big.Int).SetUint64(genesis.GasLimit))
+		if limit.Cmp(new(big.Int).SetUint64(params.MinGasLimit)) < 0 {
+			log.Error("Gas limit too low, blocks could never include transactions", "min", params.MinGasLimit)
+			continue
+		}
+		if limit.Cmp(big.NewInt(math.MaxInt64)) > 0 {
+			log.Error("Gas limit too high, blocks would be rejected by the protocol", "max", uint64(math.MaxInt64))
 			continue
 		}
+		genesis.GasLimit = limit.Uint64()
 		break
 	}
+	// Consensus all set, just ask for initial funds and go
+	fmt.Println()
+	fmt.Println("Which accounts should be pre-funded? (advisable at least one, empty line to finish)")
+	funded := make(map[common.Address]bool)
+	for {
+		// Read the address of the account to fund, malformed ones are retried
+		address := w.readAddress()
+		if address == nil {
+			break
+		}
+		if funded[*address] {
+			log.Warn("Account already pre-funded, skipping", "address", *address)
+			continue
+		}
+		funded[*address] = true
+		genesis.Alloc[*address] = core.GenesisAccount{
+			Balance: new(big.Int).Lsh(big.NewInt(1), 256-7), // 2^256 / 128 (allow many pre-funds without balance overflows)
+		}
+		log.Info("Pre-funded account", "address", *address, "total", len(funded))
+	}
 
 	fmt.Println("\n\n[aerDEV] ----------------------------------------------------------- [aerDEV]")
 	fmt.Println("[aerDEV] --- We have just preallocated some Aerum Coin to hard coded accounts --- [aerDEV]")
-	fmt.Println("[aerDEV] ----------------------------------------------------------- [aerDEV]\n\n")
+	fmt.Println("[aerDEV] ----------------------------------------------------------- [aerDEV]")
+	fmt.Println()
 
 	for aerumTeamAddress, aerumTeamBalance := range params.NewAerumPreAlloc() {
 		bigaddr, _ := new(big.Int).SetString(aerumTeamAddress, 16)
@@ -220,54 +240,58 @@ func (w *wizard) importGenesis() {
 func (w *wizard) manageGenesis() {
 	// Figure out whether to modify or export the genesis
 	fmt.Println()
-	// fmt.Println(" 1. Modify existing configurations")
-	fmt.Println(" 1. Export genesis configurations")
-	fmt.Println(" 2. Remove genesis configuration")
+	fmt.Println(" 1. Modify existing configurations")
+	fmt.Println(" 2. Export genesis configurations")
+	fmt.Println(" 3. Remove genesis configuration")
 
 	choice := w.read()
 	switch choice {
-	//case "1":
-	//	// Fork rule updating requested, iterate over each fork
-	//	fmt.Println()
-	//	fmt.Printf("Which block should Homestead come into effect? (default = %v)\n", w.conf.Genesis.Config.HomesteadBlock)
-	//	w.conf.Genesis.Config.HomesteadBlock = w.readDefaultBigInt(w.conf.Genesis.Config.HomesteadBlock)
-	//
-	//	fmt.Println()
-	//	fmt.Printf("Which block should EIP150 (Tangerine Whistle) come into effect? (default = %v)\n", w.conf.Genesis.Config.EIP150Block)
-	//	w.conf.Genesis.Config.EIP150Block = w.readDefaultBigInt(w.conf.Genesis.Config.EIP150Block)
-	//
-	//	fmt.Println()
-	//	fmt.Printf("Which block should EIP155 (Spurious Dragon) come into effect? (default = %v)\n", w.conf.Genesis.Config.EIP155Block)
-	//	w.conf.Genesis.Config.EIP155Block = w.readDefaultBigInt(w.conf.Genesis.Config.EIP155Block)
-	//
-	//	fmt.Println()
-	//	fmt.Printf("Which block should EIP158/161 (also Spurious Dragon) come into effect? (default = %v)\n", w.conf.Genesis.Config.EIP158Block)
-	//	w.conf.Genesis.Config.EIP158Block = w.readDefaultBigInt(w.conf.Genesis.Config.EIP158Block)
-	//
-	//	fmt.Println()
-	//	fmt.Printf("Which block should Byzantium come into effect? (default = %v)\n", w.conf.Genesis.Config.ByzantiumBlock)
-	//	w.conf.Genesis.Config.ByzantiumBlock = w.readDefaultBigInt(w.conf.Genesis.Config.ByzantiumBlock)
-	//
-	//	fmt.Println()
-	//	fmt.Printf("Which block should Constantinople come into effect? (default = %v)\n", w.conf.Genesis.Config.ConstantinopleBlock)
-	//	w.conf.Genesis.Config.ConstantinopleBlock = w.readDefaultBigInt(w.conf.Genesis.Config.ConstantinopleBlock)
-	//	if w.conf.Genesis.Config.PetersburgBlock == nil {
-	//		w.conf.Genesis.Config.PetersburgBlock = w.conf.Genesis.Config.ConstantinopleBlock
-	//	}
-	//	fmt.Println()
-	//	fmt.Printf("Which block should Petersburg come into effect? (default = %v)\n", w.conf.Genesis.Config.PetersburgBlock)
-	//	w.conf.Genesis.Config.PetersburgBlock = w.readDefaultBigInt(w.conf.Genesis.Config.PetersburgBlock)
-	//
-	//	out, _ := json.MarshalIndent(w.conf.Genesis.Config, "", "  ")
-	//	fmt.Printf("Chain configuration updated:\n\n%s\n", out)
-	//
-	//	w.conf.flush()
-
 	case "1":
+		// Fork rule updating requested, iterate over each fork
+		if w.conf.Genesis.Config == nil {
+			log.Error("Genesis has no chain configuration to modify")
+			return
+		}
+		fmt.Println()
+		fmt.Printf("Which block should Homestead come into effect? (default = %v)\n", w.conf.Genesis.Config.HomesteadBlock)
+		w.conf.Genesis.Config.HomesteadBlock = w.readDefaultBigInt(w.conf.Genesis.Config.HomesteadBlock)
+
+		fmt.Println()
+		fmt.Printf("Which block should EIP150 (Tangerine Whistle) come into effect? (default = %v)\n", w.conf.Genesis.Config.EIP150Block)
+		w.conf.Genesis.Config.EIP150Block = w.readDefaultBigInt(w.conf.Genesis.Config.EIP150Block)
+
+		fmt.Println()
+		fmt.Printf("Which block should EIP155 (Spurious Dragon) come into effect? (default = %v)\n", w.conf.Genesis.Config.EIP155Block)
+		w.conf.Genesis.Config.EIP155Block = w.readDefaultBigInt(w.conf.Genesis.Config.EIP155Block)
+
+		fmt.Println()
+		fmt.Printf("Which block should EIP158/161 (also Spurious Dragon) come into effect? (default = %v)\n", w.conf.Genesis.Config.EIP158Block)
+		w.conf.Genesis.Config.EIP158Block = w.readDefaultBigInt(w.conf.Genesis.Config.EIP158Block)
+
+		fmt.Println()
+		fmt.Printf("Which block should Byzantium come into effect? (default = %v)\n", w.conf.Genesis.Config.ByzantiumBlock)
+		w.conf.Genesis.Config.ByzantiumBlock = w.readDefaultBigInt(w.conf.Genesis.Config.ByzantiumBlock)
+
+		fmt.Println()
+		fmt.Printf("Which block should Constantinople come into effect? (default = %v)\n", w.conf.Genesis.Config.ConstantinopleBlock)
+		w.conf.Genesis.Config.ConstantinopleBlock = w.readDefaultBigInt(w.conf.Genesis.Config.ConstantinopleBlock)
+		if w.conf.Genesis.Config.PetersburgBlock == nil {
+			w.conf.Genesis.Config.PetersburgBlock = w.conf.Genesis.Config.ConstantinopleBlock
+		}
+		fmt.Println()
+		fmt.Printf("Which block should Petersburg come into effect? (default = %v)\n", w.conf.Genesis.Config.PetersburgBlock)
+		w.conf.Genesis.Config.PetersburgBlock = w.readDefaultBigInt(w.conf.Genesis.Config.PetersburgBlock)
+
+		out, _ := json.MarshalIndent(w.conf.Genesis.Config, "", "  ")
+		fmt.Printf("Chain configuration updated:\n\n%s\n", out)
+
+		w.conf.flush()
+
+	case "2":
 		// Save whatever genesis configuration we currently have
 		fmt.Println()
 		fmt.Printf("Which folder to save the genesis specs into? (default = current)\n")
-		fmt.Printf("  Will create %s.json, %s-aleth.json, %s-harmony.json, %s-parity.json\n", w.network, w.network, w.network, w.network)
+		fmt.Printf("  Will create %s.json, %s-aerum.json, %s-aleth.json, %s-harmony.json, %s-parity.json\n", w.network, w.network, w.network, w.network, w.network)
 
 		folder := w.readDefaultString(".")
 		if err := os.MkdirAll(folder, 0755); err != nil {
@@ -284,6 +308,12 @@ func (w *wizard) manageGenesis() {
 		}
 		log.Info("Saved native genesis chain spec", "path", gethJson)
 
+		// Export the Aerum native genesis spec carrying the consensus configs
+		if spec, err := newAerumGenesisSpec(w.network, w.conf.Genesis); err != nil {
+			log.Error("Failed to create Aerum chain spec", "err", err)
+		} else {
+			saveGenesis(folder, w.network, "aerum", spec)
+		}
 		// Export the genesis spec used by Aleth (formerly C++ Ethereum)
 		if spec, err := newAlethGenesisSpec(w.network, w.conf.Genesis); err != nil {
 			log.Error("Failed to create Aleth chain spec", "err", err)
@@ -299,7 +329,7 @@ func (w *wizard) manageGenesis() {
 		// Export the genesis spec used by Harmony (formerly EthereumJ
 		saveGenesis(folder, w.network, "harmony", w.conf.Genesis)
 
-	case "2":
+	case "3":
 		// Make sure we don't have any services running
 		if len(w.conf.servers()) > 0 {
 			log.Error("Genesis reset requires all services and servers torn down")
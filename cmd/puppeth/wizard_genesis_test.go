@@ -0,0 +1,305 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/AERUMTechnology/go-aerum/common"
+	"github.com/AERUMTechnology/go-aerum/consensus/atmos"
+	"github.com/AERUMTechnology/go-aerum/core"
+	"github.com/AERUMTechnology/go-aerum/params"
+)
+
+// newTestWizard creates a wizard managing a network in a temporary folder, fed
+// with the given scripted input and bootstrapping from the given delegates.
+func newTestWizard(t *testing.T, input string, delegates []common.Address) (*wizard, string) {
+	dir, err := ioutil.TempDir("", "puppeth-")
+	if err != nil {
+		t.Fatalf("failed to create temporary folder: %v", err)
+	}
+	w := &wizard{
+		network: "tester",
+		conf: config{
+			path:    filepath.Join(dir, "tester"),
+			Servers: make(map[string][]byte),
+		},
+		servers:   make(map[string]*sshClient),
+		services:  make(map[string][]string),
+		composers: atmos.NewFakeComposerSource(map[uint64][]common.Address{0: delegates}),
+		in:        bufio.NewReader(strings.NewReader(input)),
+	}
+	return w, dir
+}
+
+// Tests that genesis creation is aborted without flushing anything to disk if
+// governance can't provide enough bootstrap delegates.
+func TestMakeGenesisTooFewDelegates(t *testing.T) {
+	delegates := []common.Address{common.HexToAddress("0x0100000000000000000000000000000000000000")}
+
+	w, dir := newTestWizard(t, "\n\n", delegates)
+	defer os.RemoveAll(dir)
+
+	if _, err := getBootstrapDelegates(w.composers); err == nil || !strings.Contains(err.Error(), "not enough delegates") {
+		t.Errorf("error mismatch: have %v, want not enough delegates", err)
+	}
+	w.makeGenesis()
+
+	if w.conf.Genesis != nil {
+		t.Errorf("genesis created with too few delegates")
+	}
+	if _, err := os.Stat(w.conf.path); !os.IsNotExist(err) {
+		t.Errorf("configs flushed with too few delegates: %v", err)
+	}
+}
+
+// Tests that the governance contract and Ethereum endpoint entered into the
+// wizard are used for bootstrapping and land in the genesis consensus config.
+func TestMakeGenesisGovernanceOverrides(t *testing.T) {
+	delegates := []common.Address{
+		common.HexToAddress("0x0100000000000000000000000000000000000000"),
+		common.HexToAddress("0x0200000000000000000000000000000000000000"),
+		common.HexToAddress("0x0300000000000000000000000000000000000000"),
+	}
+	input := strings.Join([]string{
+		"zz00000000000000000000000000000000000000", // Malformed governance address, retried
+		"02c362540efc9FA5592621C9212D0bF776732050", // Governance address
+		"http://localhost:8545",                    // Ethereum endpoint
+		"",                                         // Consensus engine
+		"",                                         // Gas limit
+		"",                                         // Pre-funded accounts
+		"",                                         // Pre-funded precompiles
+	}, "\n") + "\n"
+
+	w, dir := newTestWizard(t, input, delegates)
+	defer os.RemoveAll(dir)
+
+	w.makeGenesis()
+	if w.conf.Genesis == nil {
+		t.Fatalf("genesis not created")
+	}
+	config := w.conf.Genesis.Config.Atmos
+	if want := common.HexToAddress("0x02c362540efc9FA5592621C9212D0bF776732050"); config.GovernanceAddress != want {
+		t.Errorf("governance address mismatch: have %x, want %x", config.GovernanceAddress, want)
+	}
+	if config.EthereumApiEndpoint != "http://localhost:8545" {
+		t.Errorf("endpoint mismatch: have %s, want %s", config.EthereumApiEndpoint, "http://localhost:8545")
+	}
+	if _, err := os.Stat(w.conf.path); err != nil {
+		t.Errorf("configs not flushed: %v", err)
+	}
+	// Without an injected source, the entered endpoint is the one queried
+	var queried int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&queried, 1)
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	w.composers = nil
+	if _, err := getBootstrapDelegates(w.bootstrapSource(server.URL, config.GovernanceAddress)); err == nil {
+		t.Errorf("bootstrap delegates retrieved from failing endpoint")
+	}
+	if atomic.LoadInt32(&queried) == 0 {
+		t.Errorf("entered endpoint not queried")
+	}
+}
+
+// Tests that the fork rules of an existing genesis can be modified through the
+// wizard, with the changes flushed to disk.
+func TestManageGenesisModifyForks(t *testing.T) {
+	input := strings.Join([]string{
+		"1", // Modify existing configurations
+		"",  // Homestead
+		"",  // EIP150
+		"",  // EIP155
+		"",  // EIP158
+		"7", // Byzantium
+		"",  // Constantinople
+		"",  // Petersburg
+	}, "\n") + "\n"
+
+	w, dir := newTestWizard(t, input, nil)
+	defer os.RemoveAll(dir)
+
+	w.conf.Genesis = &core.Genesis{
+		Difficulty: big.NewInt(1),
+		Alloc:      make(core.GenesisAlloc),
+		Config: &params.ChainConfig{
+			HomesteadBlock:      big.NewInt(0),
+			EIP150Block:         big.NewInt(0),
+			EIP155Block:         big.NewInt(0),
+			EIP158Block:         big.NewInt(0),
+			ByzantiumBlock:      big.NewInt(0),
+			ConstantinopleBlock: big.NewInt(9),
+		},
+	}
+	w.manageGenesis()
+
+	chainConfig := w.conf.Genesis.Config
+	if chainConfig.ByzantiumBlock.Cmp(big.NewInt(7)) != 0 {
+		t.Errorf("byzantium block mismatch: have %v, want %v", chainConfig.ByzantiumBlock, 7)
+	}
+	if chainConfig.PetersburgBlock == nil || chainConfig.PetersburgBlock.Cmp(chainConfig.ConstantinopleBlock) != 0 {
+		t.Errorf("petersburg block mismatch: have %v, want %v", chainConfig.PetersburgBlock, chainConfig.ConstantinopleBlock)
+	}
+	// Ensure the modifications were persisted too
+	blob, err := ioutil.ReadFile(w.conf.path)
+	if err != nil {
+		t.Fatalf("configs not flushed: %v", err)
+	}
+	var flushed config
+	if err := json.Unmarshal(blob, &flushed); err != nil {
+		t.Fatalf("failed to parse flushed configs: %v", err)
+	}
+	if flushed.Genesis.Config.ByzantiumBlock.Cmp(big.NewInt(7)) != 0 {
+		t.Errorf("flushed byzantium block mismatch: have %v, want %v", flushed.Genesis.Config.ByzantiumBlock, 7)
+	}
+}
+
+// Tests that exporting a genesis produces an Aerum native spec from which the
+// Atmos consensus configuration can be reconstructed.
+func TestManageGenesisExportAerum(t *testing.T) {
+	w, dir := newTestWizard(t, "", nil)
+	defer os.RemoveAll(dir)
+
+	w.in = bufio.NewReader(strings.NewReader("2\n" + dir + "\n"))
+	w.conf.Genesis = &core.Genesis{
+		Difficulty: big.NewInt(1),
+		Alloc:      make(core.GenesisAlloc),
+		Config: &params.ChainConfig{
+			ChainID:        big.NewInt(538),
+			HomesteadBlock: big.NewInt(0),
+			Atmos: &params.AtmosConfig{
+				Period:              3,
+				Epoch:               100,
+				GovernanceAddress:   common.HexToAddress("0x02c362540efc9FA5592621C9212D0bF776732050"),
+				EthereumApiEndpoint: "http://localhost:8545",
+			},
+		},
+	}
+	w.manageGenesis()
+
+	blob, err := ioutil.ReadFile(filepath.Join(dir, "tester-aerum.json"))
+	if err != nil {
+		t.Fatalf("aerum spec not exported: %v", err)
+	}
+	var spec aerumGenesisSpec
+	if err := json.Unmarshal(blob, &spec); err != nil {
+		t.Fatalf("failed to parse aerum spec: %v", err)
+	}
+	if spec.Atmos == nil {
+		t.Fatalf("atmos configs missing from aerum spec")
+	}
+	if !reflect.DeepEqual(spec.Atmos, w.conf.Genesis.Config.Atmos) {
+		t.Errorf("atmos configs mismatch: have %+v, want %+v", spec.Atmos, w.conf.Genesis.Config.Atmos)
+	}
+	if spec.Params.ChainID != 538 {
+		t.Errorf("chain id mismatch: have %d, want %d", spec.Params.ChainID, 538)
+	}
+}
+
+// Tests that duplicate pre-fund addresses are skipped and malformed ones are
+// retried instead of ending the pre-fund prompt.
+func TestMakeGenesisPrefundDuplicates(t *testing.T) {
+	delegates := []common.Address{
+		common.HexToAddress("0x0100000000000000000000000000000000000000"),
+		common.HexToAddress("0x0200000000000000000000000000000000000000"),
+		common.HexToAddress("0x0300000000000000000000000000000000000000"),
+	}
+	input := strings.Join([]string{
+		"", // Governance address
+		"", // Ethereum endpoint
+		"", // Consensus engine
+		"", // Gas limit
+		"aa00000000000000000000000000000000000001", // Pre-funded account
+		"aa00000000000000000000000000000000000001", // Duplicate, skipped
+		"zz00000000000000000000000000000000000002", // Malformed, retried
+		"aa00000000000000000000000000000000000002", // Pre-funded account
+		"",  // End of pre-funded accounts
+		"n", // Pre-funded precompiles
+	}, "\n") + "\n"
+
+	w, dir := newTestWizard(t, input, delegates)
+	defer os.RemoveAll(dir)
+
+	w.makeGenesis()
+	if w.conf.Genesis == nil {
+		t.Fatalf("genesis not created")
+	}
+	prefund := new(big.Int).Lsh(big.NewInt(1), 256-7)
+
+	var funded []common.Address
+	for address, account := range w.conf.Genesis.Alloc {
+		if account.Balance.Cmp(prefund) == 0 {
+			funded = append(funded, address)
+		}
+	}
+	if len(funded) != 2 {
+		t.Fatalf("pre-funded account count mismatch: have %d, want %d (%x)", len(funded), 2, funded)
+	}
+	for _, address := range []common.Address{
+		common.HexToAddress("0xaa00000000000000000000000000000000000001"),
+		common.HexToAddress("0xaa00000000000000000000000000000000000002"),
+	} {
+		if account, ok := w.conf.Genesis.Alloc[address]; !ok || account.Balance.Cmp(prefund) != 0 {
+			t.Errorf("account %x not pre-funded", address)
+		}
+	}
+}
+
+// Tests that a custom genesis gas limit can be chosen, with values outside of
+// the protocol bounds rejected and retried.
+func TestMakeGenesisGasLimit(t *testing.T) {
+	delegates := []common.Address{
+		common.HexToAddress("0x0100000000000000000000000000000000000000"),
+		common.HexToAddress("0x0200000000000000000000000000000000000000"),
+		common.HexToAddress("0x0300000000000000000000000000000000000000"),
+	}
+	input := strings.Join([]string{
+		"",                   // Governance address
+		"",                   // Ethereum endpoint
+		"",                   // Consensus engine
+		"1000",               // Gas limit below the minimum, retried
+		"0x8000000000000000", // Gas limit above the maximum, retried
+		"8000000",            // Gas limit
+		"",                   // Pre-funded accounts
+		"n",                  // Pre-funded precompiles
+	}, "\n") + "\n"
+
+	w, dir := newTestWizard(t, input, delegates)
+	defer os.RemoveAll(dir)
+
+	w.makeGenesis()
+	if w.conf.Genesis == nil {
+		t.Fatalf("genesis not created")
+	}
+	if w.conf.Genesis.GasLimit != 8000000 {
+		t.Errorf("gas limit mismatch: have %d, want %d", w.conf.Genesis.GasLimit, 8000000)
+	}
+}
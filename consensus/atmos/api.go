@@ -17,9 +17,16 @@
 package atmos
 
 import (
+	"context"
+	"fmt"
+	"math/big"
+	"net/url"
+	"reflect"
+
 	"github.com/AERUMTechnology/go-aerum/common"
 	"github.com/AERUMTechnology/go-aerum/consensus"
 	"github.com/AERUMTechnology/go-aerum/core/types"
+	"github.com/AERUMTechnology/go-aerum/log"
 	"github.com/AERUMTechnology/go-aerum/rpc"
 )
 
@@ -33,12 +40,8 @@ type API struct {
 // GetSnapshot retrieves the state snapshot at a given block.
 func (api *API) GetSnapshot(number *rpc.BlockNumber) (*Snapshot, error) {
 	// Retrieve the requested block number (or current if none requested)
-	var header *types.Header
-	if number == nil || *number == rpc.LatestBlockNumber {
-		header = api.chain.CurrentHeader()
-	} else {
-		header = api.chain.GetHeaderByNumber(uint64(number.Int64()))
-	}
+	header := api.header(number)
+
 	// Ensure we have an actually valid block and return its snapshot
 	if header == nil {
 		return nil, errUnknownBlock
@@ -58,12 +61,8 @@ func (api *API) GetSnapshotAtHash(hash common.Hash) (*Snapshot, error) {
 // GetSigners retrieves the list of authorized signers at the specified block.
 func (api *API) GetSigners(number *rpc.BlockNumber) ([]common.Address, error) {
 	// Retrieve the requested block number (or current if none requested)
-	var header *types.Header
-	if number == nil || *number == rpc.LatestBlockNumber {
-		header = api.chain.CurrentHeader()
-	} else {
-		header = api.chain.GetHeaderByNumber(uint64(number.Int64()))
-	}
+	header := api.header(number)
+
 	// Ensure we have an actually valid block and return the signers from its snapshot
 	if header == nil {
 		return nil, errUnknownBlock
@@ -75,7 +74,7 @@ func (api *API) GetSigners(number *rpc.BlockNumber) ([]common.Address, error) {
 	return snap.signers(), nil
 }
 
-// GetSignersAtHash retrieves the state snapshot at a given block.
+// GetSignersAtHash retrieves the list of authorized signers at the specified block.
 func (api *API) GetSignersAtHash(hash common.Hash) ([]common.Address, error) {
 	header := api.chain.GetHeaderByHash(hash)
 	if header == nil {
@@ -86,4 +85,362 @@ func (api *API) GetSignersAtHash(hash common.Hash) ([]common.Address, error) {
 		return nil, err
 	}
 	return snap.signers(), nil
-}
\ No newline at end of file
+}
+
+// Added by Aerum
+// Proposals returns the current proposals the node tries to uphold and vote on.
+func (api *API) Proposals() map[common.Address]bool {
+	api.atmos.lock.RLock()
+	defer api.atmos.lock.RUnlock()
+
+	proposals := make(map[common.Address]bool)
+	for address, auth := range api.atmos.proposals {
+		proposals[address] = auth
+	}
+	return proposals
+}
+
+// Added by Aerum
+// Propose injects a new authorization proposal that the signer will cast into
+// the blocks it prepares. Requires local proposals to be allowed.
+//
+// The votes are advisory only: signer sets are selected by governance and
+// snapshots never tally the cast votes, so a proposal doesn't change who may
+// seal blocks.
+func (api *API) Propose(address common.Address, auth bool) error {
+	if !api.atmos.config.AllowLocalProposals {
+		return errLocalOverridesDisabled
+	}
+	api.atmos.lock.Lock()
+	defer api.atmos.lock.Unlock()
+
+	api.atmos.proposals[address] = auth
+	return nil
+}
+
+// Added by Aerum
+// Discard drops a currently running proposal, stopping the signer from casting
+// further votes (either for or against). Requires local proposals to be allowed.
+func (api *API) Discard(address common.Address) error {
+	if !api.atmos.config.AllowLocalProposals {
+		return errLocalOverridesDisabled
+	}
+	api.atmos.lock.Lock()
+	defer api.atmos.lock.Unlock()
+
+	delete(api.atmos.proposals, address)
+	return nil
+}
+
+// Added by Aerum
+// RefreshComposers drops the cached governance signers of the current epoch and
+// reloads them, returning the size of the new signer set. The refreshed set is
+// used by epoch snapshots rebuilt from governance, snapshots already derived
+// from the old one are unaffected. Requires local proposals to be allowed.
+func (api *API) RefreshComposers() (int, error) {
+	if !api.atmos.config.AllowLocalProposals {
+		return 0, errLocalOverridesDisabled
+	}
+	signers, err := api.atmos.refreshEpochSigners(api.chain, api.chain.CurrentHeader().Number.Uint64())
+	if err != nil {
+		return 0, err
+	}
+	return len(signers), nil
+}
+
+// Added by Aerum
+// RepairSnapshot discards the stored snapshot of the given epoch and rebuilds it,
+// recovering from a corrupted database entry without a resync.
+func (api *API) RepairSnapshot(epoch uint64) error {
+	return api.atmos.RepairSnapshot(api.chain, epoch)
+}
+
+// Added by Aerum
+// GetNextSigner retrieves the signer expected to seal the specified block in-turn,
+// based on the snapshot at its parent. A missing number or the pending sentinel
+// refer to the block following the current head.
+func (api *API) GetNextSigner(number *rpc.BlockNumber) (common.Address, error) {
+	var next uint64
+	switch {
+	case number == nil || *number == rpc.PendingBlockNumber:
+		next = api.chain.CurrentHeader().Number.Uint64() + 1
+	case *number == rpc.LatestBlockNumber:
+		next = api.chain.CurrentHeader().Number.Uint64()
+	default:
+		next = uint64(number.Int64())
+	}
+	// The genesis block is not sealed, so nobody is in-turn for it
+	if next == 0 {
+		return common.Address{}, errUnknownBlock
+	}
+	parent := api.chain.GetHeaderByNumber(next - 1)
+	if parent == nil {
+		return common.Address{}, errUnknownBlock
+	}
+	snap, err := api.atmos.snapshot(api.chain, parent.Number.Uint64(), parent.Hash(), nil)
+	if err != nil {
+		return common.Address{}, err
+	}
+	return snap.inturnSigner(next), nil
+}
+
+// Added by Aerum
+// ExportSnapshots retrieves the snapshots at all the epoch checkpoints within the
+// given (inclusive) block range, for offline analysis of a node's consensus view.
+func (api *API) ExportSnapshots(start, end rpc.BlockNumber) ([]*Snapshot, error) {
+	first, last := api.header(&start), api.header(&end)
+	if first == nil || last == nil {
+		return nil, errUnknownBlock
+	}
+	from, to := first.Number.Uint64(), last.Number.Uint64()
+	if from > to {
+		return nil, fmt.Errorf("invalid snapshot range: start #%d after end #%d", from, to)
+	}
+	// Walk the checkpoints, starting at the first one not before the range start
+	epoch := api.atmos.config.Epoch
+
+	var snaps []*Snapshot
+	for number := (from + epoch - 1) / epoch * epoch; number <= to; number += epoch {
+		header := api.chain.GetHeaderByNumber(number)
+		if header == nil {
+			return nil, errUnknownBlock
+		}
+		snap, err := api.atmos.snapshot(api.chain, number, header.Hash(), nil)
+		if err != nil {
+			return nil, err
+		}
+		snaps = append(snaps, snap)
+	}
+	return snaps, nil
+}
+
+// Added by Aerum
+// GetSigningStats counts the blocks sealed by each signer within the given
+// (inclusive) block range. The genesis block is not sealed, so it's skipped. The
+// range is capped to the configured maximum span to bound the header walk.
+func (api *API) GetSigningStats(start, end rpc.BlockNumber) (map[common.Address]uint64, error) {
+	first, last := api.header(&start), api.header(&end)
+	if first == nil || last == nil {
+		return nil, errUnknownBlock
+	}
+	from, to := first.Number.Uint64(), last.Number.Uint64()
+	if from > to {
+		return nil, fmt.Errorf("invalid stats range: start #%d after end #%d", from, to)
+	}
+	if span := to - from + 1; span > api.atmos.config.MaxStatsSpan {
+		return nil, fmt.Errorf("stats range too large: %d blocks, max %d", span, api.atmos.config.MaxStatsSpan)
+	}
+	if from == 0 {
+		from = 1
+	}
+	stats := make(map[common.Address]uint64)
+	for number := from; number <= to; number++ {
+		header := api.chain.GetHeaderByNumber(number)
+		if header == nil {
+			return nil, errUnknownBlock
+		}
+		signer, err := ecrecover(header, api.atmos.signatures, api.atmos.sealHashes)
+		if err != nil {
+			return nil, err
+		}
+		stats[signer]++
+	}
+	return stats, nil
+}
+
+// Added by Aerum
+// SnapshotChainReport is the outcome of verifying the checkpoints of a block range
+// against the locally computed snapshots.
+type SnapshotChainReport struct {
+	Checked  uint64           `json:"checked"`            // Number of checkpoints verified
+	Mismatch *uint64          `json:"mismatch"`           // First checkpoint with diverging signers (nil = none)
+	Hash     *common.Hash     `json:"hash,omitempty"`     // Hash of the diverging checkpoint
+	Embedded []common.Address `json:"embedded,omitempty"` // Signers embedded into the diverging checkpoint
+	Computed []common.Address `json:"computed,omitempty"` // Signers of the locally computed snapshot
+}
+
+// Added by Aerum
+// VerifySnapshotChain checks that the signers embedded into all the epoch
+// checkpoints within the given (inclusive) block range match the locally rebuilt
+// committees, reporting the first divergent checkpoint. As consensus does, every
+// checkpoint is checked against the snapshot of its parent, i.e. the committee of
+// the epoch it closes, apart from the genesis which embeds its own.
+func (api *API) VerifySnapshotChain(start, end rpc.BlockNumber) (*SnapshotChainReport, error) {
+	first, last := api.header(&start), api.header(&end)
+	if first == nil || last == nil {
+		return nil, errUnknownBlock
+	}
+	from, to := first.Number.Uint64(), last.Number.Uint64()
+	if from > to {
+		return nil, fmt.Errorf("invalid verification range: start #%d after end #%d", from, to)
+	}
+	epoch := api.atmos.config.Epoch
+
+	report := new(SnapshotChainReport)
+	for number := (from + epoch - 1) / epoch * epoch; number <= to; number += epoch {
+		header := api.chain.GetHeaderByNumber(number)
+		if header == nil {
+			return nil, errUnknownBlock
+		}
+		parentNumber, parentHash := number, header.Hash()
+		if number > 0 {
+			parentNumber, parentHash = number-1, header.ParentHash
+		}
+		snap, err := api.atmos.snapshot(api.chain, parentNumber, parentHash, nil)
+		if err != nil {
+			return nil, err
+		}
+		report.Checked++
+
+		embedded := checkpointSigners(header)
+		if computed := snap.signers(); !reflect.DeepEqual(embedded, computed) {
+			hash := header.Hash()
+			report.Mismatch, report.Hash = &number, &hash
+			report.Embedded, report.Computed = embedded, computed
+			break
+		}
+	}
+	return report, nil
+}
+
+// Added by Aerum
+// ComposerDebug contains the inputs and the outcome of the signer selection for
+// an epoch block, to inspect why a node picked a given committee.
+type ComposerDebug struct {
+	Number    uint64           `json:"number"`    // Epoch block the committee was selected for
+	Timestamp *big.Int         `json:"timestamp"` // Governance lookup time (composersCheckTimestamp)
+	Composers []common.Address `json:"composers"` // Full composer list loaded from governance
+	Stakes    []*big.Int       `json:"stakes"`    // Stakes of the composers, in the same order
+	Seed      int64            `json:"seed"`      // Seed of the weighted random selection
+	Selected  []common.Address `json:"selected"`  // Committee selected out of the composers
+}
+
+// Added by Aerum
+// DebugComposers loads the full composer list for the given epoch through the
+// configured composer source and recomputes the committee selected out of it,
+// without touching the cached signers. The epoch block must already be known.
+func (api *API) DebugComposers(epoch uint64) (*ComposerDebug, error) {
+	if api.atmos.config.StaticSigners {
+		return nil, errStaticSigners
+	}
+	number := epoch * api.atmos.config.Epoch
+	timestamp, err := getComposersCheckTimestamp(api.atmos.config, api.chain, number, nil)
+	if err != nil {
+		return nil, err
+	}
+	composers, stakes, err := api.listComposers(number, timestamp)
+	if err != nil {
+		return nil, err
+	}
+	_, totalWeight := stakeWeights(stakes)
+
+	return &ComposerDebug{
+		Number:    number,
+		Timestamp: timestamp,
+		Composers: composers,
+		Stakes:    stakes,
+		Seed:      selectionSeed(totalWeight, number),
+		Selected:  signersProbabilisticSelection(api.atmos.config, composers, stakes, number),
+	}, nil
+}
+
+// Added by Aerum
+// SimulateCommittee projects the committee of a future epoch by selecting the
+// signers out of the composers currently registered in governance. The result
+// only reflects the current governance state, so it may change as composers join,
+// leave or restake before the epoch is reached. No snapshot is touched.
+func (api *API) SimulateCommittee(epoch uint64) ([]common.Address, error) {
+	if api.atmos.config.StaticSigners {
+		return nil, errStaticSigners
+	}
+	head := api.chain.CurrentHeader()
+
+	number := epoch * api.atmos.config.Epoch
+	if number <= head.Number.Uint64() {
+		return nil, fmt.Errorf("epoch %d already reached at block #%d", epoch, number)
+	}
+	// Look governance up as if the epoch block followed the current head
+	timestamp := int64(head.Time) - *api.atmos.config.GovernanceLookbackSeconds
+	if timestamp < 0 {
+		timestamp = 0
+	}
+	composers, stakes, err := api.listComposers(number, big.NewInt(timestamp))
+	if err != nil {
+		return nil, err
+	}
+	return signersProbabilisticSelection(api.atmos.config, composers, stakes, number), nil
+}
+
+// listComposers loads the full composer list for an epoch block through the
+// configured composer source, if it supports listing them.
+func (api *API) listComposers(number uint64, timestamp *big.Int) ([]common.Address, []*big.Int, error) {
+	api.atmos.lock.RLock()
+	source := api.atmos.source
+	api.atmos.lock.RUnlock()
+
+	lister, ok := source.(ComposerLister)
+	if !ok {
+		return nil, nil, errComposerListingUnsupported
+	}
+	ctx, cancel := context.WithTimeout(api.atmos.ctx, api.atmos.config.GovernanceCallTimeout)
+	defer cancel()
+
+	composers, stakes, err := lister.ListComposers(ctx, number, timestamp)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(composers) != len(stakes) {
+		log.Warn("Composer source returned mismatching stakes", "number", number, "composers", len(composers), "stakes", len(stakes))
+		return nil, nil, errComposerStakesMismatch
+	}
+	return composers, stakes, nil
+}
+
+// Added by Aerum
+// GovernanceInfo describes the governance contract a node resolved from its chain
+// config and the Ethereum endpoints it queries it through.
+type GovernanceInfo struct {
+	Endpoints  []string       `json:"endpoints"`  // Ethereum endpoints in the order tried, credentials redacted
+	Governance common.Address `json:"governance"` // Address of the governance contract
+	TestNet    bool           `json:"testnet"`    // Whether the test network defaults are in effect
+}
+
+// Added by Aerum
+// GovernanceInfo retrieves the governance contract address and the Ethereum
+// endpoints the node resolved, to confirm which network it reads signers from.
+func (api *API) GovernanceInfo() (*GovernanceInfo, error) {
+	config := api.atmos.config
+
+	endpoints := getEthereumApiEndpoints(config)
+	for i, endpoint := range endpoints {
+		endpoints[i] = redactEndpoint(endpoint)
+	}
+	return &GovernanceInfo{
+		Endpoints:  endpoints,
+		Governance: getGovernanceAddress(config),
+		TestNet:    config.EnableTestNet,
+	}, nil
+}
+
+// redactEndpoint masks any password embedded into an endpoint URL. Endpoints not
+// parsable as URLs (e.g. IPC paths) are returned as is.
+func redactEndpoint(endpoint string) string {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.User == nil {
+		return endpoint
+	}
+	if _, ok := u.User.Password(); !ok {
+		return endpoint
+	}
+	u.User = url.UserPassword(u.User.Username(), "xxxxx")
+	return u.String()
+}
+
+// header resolves the header at the requested block number, treating a missing
+// number and the latest and pending sentinels as the current head.
+func (api *API) header(number *rpc.BlockNumber) *types.Header {
+	if number == nil || *number == rpc.LatestBlockNumber || *number == rpc.PendingBlockNumber {
+		return api.chain.CurrentHeader()
+	}
+	return api.chain.GetHeaderByNumber(uint64(number.Int64()))
+}
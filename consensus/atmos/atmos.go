@@ -19,11 +19,14 @@ package atmos
 
 import (
 	"bytes"
+	"context"
 	"errors"
+	"fmt"
 	"io"
 	"math"
 	"math/big"
 	"math/rand"
+	"runtime"
 	"strings"
 	"sync"
 	"time"
@@ -31,6 +34,7 @@ import (
 	"github.com/AERUMTechnology/go-aerum/accounts"
 	"github.com/AERUMTechnology/go-aerum/accounts/abi/bind"
 	"github.com/AERUMTechnology/go-aerum/common"
+	"github.com/AERUMTechnology/go-aerum/common/hexutil"
 	"github.com/AERUMTechnology/go-aerum/consensus"
 	"github.com/AERUMTechnology/go-aerum/consensus/misc"
 	guvnor "github.com/AERUMTechnology/go-aerum/contracts/atmosGovernance"
@@ -48,30 +52,44 @@ import (
 )
 
 const (
-	inmemorySnapshots  = 128  // Number of recent vote snapshots to keep in memory
-	inmemorySignatures = 4096 // Number of recent block signatures to keep in memory
-
-	wiggleTime = 1000 * time.Millisecond // Random delay (per signer) to allow concurrent signers
-
-	recentsTimeout  = 30 * time.Second // Timeout between signing blocks in case signer is recent
-	numberOfSigners = 10               // Maximum number of signers available in epoch
+	inmemorySnapshots  = 128  // Default number of recent vote snapshots to keep in memory
+	inmemorySignatures = 4096 // Default number of recent block signatures to keep in memory
+	inmemorySealHashes = 4096 // Number of recent block seal hashes to keep in memory
+	inmemoryComposers  = 64   // Default number of governance composer sets to keep in memory
+
+	maxStatsSpan          = 100000 // Default maximum number of blocks signing statistics can be gathered over
+	maxTreasuryBps        = 10000  // Treasury cut in basis points amounting to the full block reward
+	snapshotWalkWarnDepth = 1000   // Default number of headers a snapshot lookup may walk back before warning
+
+	wiggleTime      = 1000 * time.Millisecond // Default random delay (per signer) to allow concurrent signers
+	emptyBlockDelay = 1000 * time.Millisecond // Minimum delay before releasing empty blocks on zero-period chains
+
+	recentsTimeout     = 30 * time.Second // Default timeout between signing blocks in case signer is recent
+	numberOfSigners    = 10               // Default maximum number of signers available in epoch
+	minSignersPerEpoch = 2                // Minimum number of signers allowed to be configured per epoch
+
+	governanceCallTimeout = 20 * time.Second       // Default deadline for governance contract calls
+	governanceRetries     = 3                      // Default number of retries for failed governance lookups
+	governanceRetryDelay  = 500 * time.Millisecond // Initial delay between governance retries, doubled on each retry
+	governanceLookback    = 20 * 60                // Default seconds to look back from the parent block to make sure Ethereum synced with no forks
 )
 
 // Atmos proof-of-authority protocol constants.
 var (
 	// Added by Aerum
-	BlockReward = params.NewAtmosBlockRewards() // Block reward in wei for successfully mining a block
+	dialEthereum = ethclient.DialContext // Dialer used to reach the Ethereum endpoints, replaceable in tests
 
-	epochLength = params.NewAtmosEpochInterval() // Default number of blocks after which to checkpoint and reset the pending votes
-	blockPeriod = params.NewAtmosBlockInterval() // Default minimum difference between two consecutive block's timestamps
+	// Added by Aerum
+	nonceAuthVote = hexutil.MustDecode("0xffffffffffffffff") // Magic nonce number to vote on adding a new signer
+	nonceDropVote = hexutil.MustDecode("0x0000000000000000") // Magic nonce number to vote on removing a signer.
 
 	extraVanity = 32 // Fixed number of extra-data prefix bytes reserved for signer vanity
 	extraSeal   = 65 // Fixed number of extra-data suffix bytes reserved for signer seal
 
 	uncleHash = types.CalcUncleHash(nil) // Always Keccak256(RLP([])) as uncles are meaningless outside of PoW.
 
-	diffInTurn = big.NewInt(2) // Block difficulty for in-turn signatures
-	diffNoTurn = big.NewInt(1) // Block difficulty for out-of-turn signatures
+	diffInTurn = big.NewInt(2) // Default block difficulty for in-turn signatures
+	diffNoTurn = big.NewInt(1) // Default block difficulty for out-of-turn signatures
 )
 
 // Various error messages to mark blocks invalid. These should be private to
@@ -136,16 +154,118 @@ var (
 	errRecentlySigned = errors.New("recently signed")
 
 	// Added by Aerum
-	// errInvalidNumberOfSigners is returned if number of signers is less than 2.
+	// errInvalidNumberOfSigners is returned if number of signers is less than the
+	// configured minimum.
 	errInvalidNumberOfSigners = errors.New("invalid number of signers")
+
+	// Added by Aerum
+	// errInvalidTurnDifficulties is returned if the configured in-turn difficulty
+	// doesn't exceed the out-of-turn one.
+	errInvalidTurnDifficulties = errors.New("in-turn difficulty must exceed out-of-turn difficulty")
+
+	// Added by Aerum
+	// errInvalidBootstrapPeriod is returned if the bootstrap block period is zero
+	// or slower than the regular block period.
+	errInvalidBootstrapPeriod = errors.New("bootstrap period must be non-zero and not exceed the block period")
+
+	// Added by Aerum
+	// errInvalidCacheSize is returned if a configured cache size is negative.
+	errInvalidCacheSize = errors.New("cache size must be positive")
+
+	// Added by Aerum
+	// errInvalidDuration is returned if a configured sealing delay is negative.
+	errInvalidDuration = errors.New("duration must not be negative")
+
+	// Added by Aerum
+	// errInvalidTreasuryCut is returned if the treasury reward share exceeds the
+	// full reward, or no treasury address is configured to receive it.
+	errInvalidTreasuryCut = errors.New("treasury cut must target an address and not exceed 10000 bps")
+
+	// Added by Aerum
+	// errCoinbaseNotSigner is returned if a non-checkpoint block's beneficiary isn't
+	// its signer, on chains enforcing the two to match.
+	errCoinbaseNotSigner = errors.New("beneficiary in non-checkpoint block isn't the signer")
+
+	// Added by Aerum
+	// errEngineClosed is returned if a snapshot is requested after the engine has
+	// been shut down.
+	errEngineClosed = errors.New("atmos engine closed")
+
+	// Added by Aerum
+	// errGovernanceNodeBehind is returned if the Ethereum node serving the governance
+	// contract hasn't synced up to the timestamp the composers are needed at.
+	errGovernanceNodeBehind = errors.New("governance node behind lookup timestamp")
+
+	// Added by Aerum
+	// errComposerStakesMismatch is returned if the governance contract returns a
+	// different number of stakes than composers.
+	errComposerStakesMismatch = errors.New("governance composer and stake counts differ")
+
+	// Added by Aerum
+	// errNoComposers is returned by the governance health check if the contract is
+	// reachable, but has no composers registered.
+	errNoComposers = errors.New("no composers configured in governance contract")
+
+	// Added by Aerum
+	// errLocalOverridesDisabled is returned if an operator tries to manually interfere
+	// with the signer committee without local proposals being allowed.
+	errLocalOverridesDisabled = errors.New("local overrides disabled")
+
+	// Added by Aerum
+	// errStaticSigners is returned if the governance signers are requested on a
+	// chain running with a static signer set.
+	errStaticSigners = errors.New("static signers, governance disabled")
+
+	// Added by Aerum
+	// errComposerListingUnsupported is returned if the full composer set is
+	// requested from a composer source unable to list it.
+	errComposerListingUnsupported = errors.New("composer source can't list composers")
 )
 
+// Added by Aerum
+// HeaderVerificationError is returned by the header and seal verifications,
+// identifying the offending header. The reason the header was rejected is kept
+// in Err and returned by Unwrap, so it can be compared against the verification
+// errors directly or matched with errors.Is on toolchains supporting it.
+type HeaderVerificationError struct {
+	Number uint64      // Number of the header failing verification
+	Hash   common.Hash // Hash of the header failing verification
+	Err    error       // Reason the header failed verification
+}
+
+// Error implements error, prefixing the failure reason with the header details.
+func (e *HeaderVerificationError) Error() string {
+	return fmt.Sprintf("invalid header #%d [%x]: %v", e.Number, e.Hash, e.Err)
+}
+
+// Unwrap returns the reason the header failed verification.
+func (e *HeaderVerificationError) Unwrap() error {
+	return e.Err
+}
+
+// Added by Aerum
+// wrapHeaderError annotates a verification failure with the offending header.
+// The consensus package errors the chain machinery reacts to by identity (e.g.
+// queueing future blocks) are passed through untouched.
+func wrapHeaderError(header *types.Header, err error) error {
+	switch err {
+	case nil, consensus.ErrUnknownAncestor, consensus.ErrPrunedAncestor, consensus.ErrFutureBlock, consensus.ErrInvalidNumber:
+		return err
+	}
+	var number uint64
+	if header.Number != nil {
+		number = header.Number.Uint64()
+	}
+	return &HeaderVerificationError{Number: number, Hash: header.Hash(), Err: err}
+}
+
 // SignerFn is a signer callback function to request a header to be signed by a
 // backing account.
 type SignerFn func(accounts.Account, string, []byte) ([]byte, error)
 
-// ecrecover extracts the Ethereum account address from a signed header.
-func ecrecover(header *types.Header, sigcache *lru.ARCCache) (common.Address, error) {
+// ecrecover extracts the Ethereum account address from a signed header. The seal
+// hash cache is optional and may be nil.
+func ecrecover(header *types.Header, sigcache *lru.ARCCache, sealcache *lru.ARCCache) (common.Address, error) {
 	// If the signature's already cached, return that
 	hash := header.Hash()
 	if address, known := sigcache.Get(hash); known {
@@ -158,7 +278,11 @@ func ecrecover(header *types.Header, sigcache *lru.ARCCache) (common.Address, er
 	signature := header.Extra[len(header.Extra)-extraSeal:]
 
 	// Recover the public key and the Ethereum address
-	pubkey, err := crypto.Ecrecover(SealHash(header).Bytes(), signature)
+	sighash, err := cachedSealHash(header, hash, sealcache)
+	if err != nil {
+		return common.Address{}, err
+	}
+	pubkey, err := crypto.Ecrecover(sighash.Bytes(), signature)
 	if err != nil {
 		return common.Address{}, err
 	}
@@ -169,6 +293,10 @@ func ecrecover(header *types.Header, sigcache *lru.ARCCache) (common.Address, er
 	return signer, nil
 }
 
+// SignersChangedFn is a callback invoked when the signer committee of a new epoch
+// differs from the one of the previous epoch. Both sets are sorted ascending.
+type SignersChangedFn func(number uint64, old, new []common.Address)
+
 // Atmos is the proof-of-authority consensus engine proposed to support the
 // Ethereum testnet following the Ropsten attacks.
 type Atmos struct {
@@ -177,10 +305,30 @@ type Atmos struct {
 
 	recents    *lru.ARCCache // Snapshots for recent block to speed up reorgs
 	signatures *lru.ARCCache // Signatures of recent blocks to speed up mining
+	sealHashes *lru.ARCCache // Seal hashes of recent blocks to avoid rehashing them
+	composers  *lru.ARCCache // Signers loaded from governance to avoid repeated Ethereum round-trips
+
+	source ComposerSource // Source of the epoch signers, the governance contract by default
+
+	lastSigners      []common.Address // Most recent signer set successfully loaded from governance
+	lastSignersEpoch uint64           // Epoch the most recent governance signer set was loaded for
+
+	proposals map[common.Address]bool // Current list of proposals we are pushing
 
 	signer common.Address // Ethereum address of the signing key
 	signFn SignerFn       // Signer function to authorize hashes with
-	lock   sync.RWMutex   // Protects the signer fields
+
+	onSignersChanged SignersChangedFn // Optional hook fired on signer committee rotation
+
+	ctx    context.Context    // Context cancelled on Close to abort in-flight governance lookups
+	cancel context.CancelFunc // Cancels the engine context, tearing down governance lookups
+
+	lock sync.RWMutex // Protects the signer, proposal, source, last signers and hook fields
+
+	randSource rand.Source // Source of the out-of-turn sealing wiggle, replaceable by tests
+	randLock   sync.Mutex  // Protects the random source, which isn't safe for concurrent use
+
+	clock func() time.Time // Source of the current time, replaceable by tests
 
 	// The fields below are for testing only
 	fakeDiff bool // Skip difficulty verifications
@@ -189,82 +337,378 @@ type Atmos struct {
 // New creates a Atmos proof-of-authority consensus engine with the initial
 // signers set to the ones provided by the user.
 func New(config *params.AtmosConfig, db ethdb.Database) *Atmos {
+	// Added by Aerum
+	if err := params.AtmosParamsEnvError(); err != nil {
+		log.Warn("Invalid Atmos environment overrides, using built-in parameters", "err", err)
+	}
 	// Set any missing consensus parameters to their defaults
 	conf := *config
 	if conf.Epoch == 0 {
-		conf.Epoch = epochLength
+		conf.Epoch = params.NewAtmosEpochInterval()
+	}
+	if conf.Period == 0 && !conf.DevMode && conf.StrictRulesBlock != nil {
+		log.Warn("Zero block period is only allowed in dev mode, using default after strict rules block", "updated", params.NewAtmosBlockInterval(), "block", conf.StrictRulesBlock)
+	}
+	if conf.GovernanceCallTimeout == 0 {
+		conf.GovernanceCallTimeout = governanceCallTimeout
+	}
+	if conf.ComposersCacheSize <= 0 {
+		conf.ComposersCacheSize = inmemoryComposers
+	}
+	if conf.SignatureCacheSize < 0 {
+		log.Warn("Invalid signature cache size, using default", "provided", conf.SignatureCacheSize, "updated", inmemorySignatures, "err", errInvalidCacheSize)
+	}
+	if conf.SignatureCacheSize <= 0 {
+		conf.SignatureCacheSize = inmemorySignatures
+	}
+	if conf.SnapshotCacheSize < 0 {
+		log.Warn("Invalid snapshot cache size, using default", "provided", conf.SnapshotCacheSize, "updated", inmemorySnapshots, "err", errInvalidCacheSize)
+	}
+	if conf.SnapshotCacheSize <= 0 {
+		conf.SnapshotCacheSize = inmemorySnapshots
+	}
+	if conf.WiggleTime < 0 {
+		log.Warn("Invalid wiggle time, using default", "provided", conf.WiggleTime, "updated", wiggleTime, "err", errInvalidDuration)
+		conf.WiggleTime = wiggleTime
+	}
+	if conf.WiggleTime == 0 {
+		conf.WiggleTime = wiggleTime
+	}
+	if conf.RecentsTimeout < 0 {
+		log.Warn("Invalid recents timeout, using default", "provided", conf.RecentsTimeout, "updated", recentsTimeout, "err", errInvalidDuration)
+		conf.RecentsTimeout = recentsTimeout
+	}
+	if conf.RecentsTimeout == 0 {
+		conf.RecentsTimeout = recentsTimeout
+	}
+	if conf.GovernanceRetries == 0 {
+		conf.GovernanceRetries = governanceRetries
+	}
+	if conf.GovernanceLookbackSeconds != nil && *conf.GovernanceLookbackSeconds < 0 {
+		log.Warn("Invalid governance lookback, using default", "provided", *conf.GovernanceLookbackSeconds, "updated", governanceLookback, "err", errInvalidDuration)
+		conf.GovernanceLookbackSeconds = nil
+	}
+	if conf.GovernanceLookbackSeconds == nil {
+		lookback := int64(governanceLookback)
+		conf.GovernanceLookbackSeconds = &lookback
+	}
+	if conf.SignersPerEpoch == 0 {
+		conf.SignersPerEpoch = numberOfSigners
+	}
+	if conf.SignersPerEpoch < minSignersPerEpoch {
+		log.Warn("Invalid number of signers per epoch, using minimum", "provided", conf.SignersPerEpoch, "updated", minSignersPerEpoch, "err", errInvalidNumberOfSigners)
+		conf.SignersPerEpoch = minSignersPerEpoch
+	}
+	if inturn, noturn := turnDifficulty(&conf, true), turnDifficulty(&conf, false); inturn.Cmp(noturn) <= 0 {
+		log.Warn("Invalid turn difficulties, using defaults", "inturn", inturn, "noturn", noturn, "err", errInvalidTurnDifficulties)
+		conf.InTurnDifficulty, conf.OutOfTurnDifficulty = 0, 0
+	}
+	if conf.BootstrapFastBlocks > 0 && (conf.BootstrapFastPeriod == 0 || conf.BootstrapFastPeriod > conf.Period) {
+		log.Warn("Invalid bootstrap block period, disabling ramp", "provided", conf.BootstrapFastPeriod, "period", conf.Period, "err", errInvalidBootstrapPeriod)
+		conf.BootstrapFastBlocks, conf.BootstrapFastPeriod = 0, 0
+	}
+	if conf.TreasuryRewardBps > 0 && (conf.TreasuryRewardBps > maxTreasuryBps || conf.TreasuryAddress == (common.Address{})) {
+		log.Warn("Invalid treasury cut, disabling it", "provided", conf.TreasuryRewardBps, "treasury", conf.TreasuryAddress, "err", errInvalidTreasuryCut)
+		conf.TreasuryRewardBps = 0
+	}
+	if conf.MaxStatsSpan == 0 {
+		conf.MaxStatsSpan = maxStatsSpan
+	}
+	if conf.SnapshotWalkWarnDepth == 0 {
+		conf.SnapshotWalkWarnDepth = snapshotWalkWarnDepth
+	}
+	if conf.MinSigners <= 0 {
+		conf.MinSigners = minSignersPerEpoch
+	}
+	if len(conf.Vanity) > extraVanity {
+		log.Warn("Vanity too long, truncating", "provided", len(conf.Vanity), "updated", extraVanity)
+		conf.Vanity = conf.Vanity[:extraVanity]
+	}
+	conf.Vanity = common.CopyBytes(conf.Vanity)
+	if conf.TrustedCheckpoints != nil {
+		trusted := make(map[uint64][]common.Address, len(conf.TrustedCheckpoints))
+		for epoch, signers := range conf.TrustedCheckpoints {
+			trusted[epoch] = sortAndDedupSigners(append([]common.Address(nil), signers...))
+		}
+		conf.TrustedCheckpoints = trusted
 	}
 	// Allocate the snapshot caches and create the engine
-	recents, _ := lru.NewARC(inmemorySnapshots)
-	signatures, _ := lru.NewARC(inmemorySignatures)
+	recents, _ := lru.NewARC(conf.SnapshotCacheSize)
+	signatures, _ := lru.NewARC(conf.SignatureCacheSize)
+	sealHashes, _ := lru.NewARC(inmemorySealHashes)
+	composers, _ := lru.NewARC(conf.ComposersCacheSize)
+
+	ctx, cancel := context.WithCancel(context.Background())
 
-	return &Atmos{
+	engine := &Atmos{
 		config:     &conf,
 		db:         db,
 		recents:    recents,
 		signatures: signatures,
+		sealHashes: sealHashes,
+		composers:  composers,
+		source:     &governanceSource{config: &conf},
+		proposals:  make(map[common.Address]bool),
+		randSource: rand.NewSource(time.Now().UnixNano()),
+		clock:      time.Now,
+		ctx:        ctx,
+		cancel:     cancel,
+	}
+	// Restore the last governance signers, so the grace period survives restarts
+	if db != nil {
+		if epoch, signers, err := loadLastSigners(db); err == nil && len(signers) > 0 {
+			engine.lastSigners, engine.lastSignersEpoch = signers, epoch
+		}
 	}
+	return engine
+}
+
+// Added by Aerum
+// NewWithClock creates an Atmos consensus engine similarly to New, but reading the
+// current time from the given clock instead of the system one. It is meant for
+// tests exercising time sensitive paths without sleeping.
+func NewWithClock(config *params.AtmosConfig, db ethdb.Database, clock func() time.Time) *Atmos {
+	engine := New(config, db)
+	engine.clock = clock
+	return engine
 }
 
 // Author implements consensus.Engine, returning the Ethereum address recovered
 // from the signature in the header's extra-data section.
 func (a *Atmos) Author(header *types.Header) (common.Address, error) {
-	return ecrecover(header, a.signatures)
+	return ecrecover(header, a.signatures, a.sealHashes)
 }
 
 // VerifyHeader checks whether a header conforms to the consensus rules.
 func (a *Atmos) VerifyHeader(chain consensus.ChainReader, header *types.Header, seal bool) error {
-	return a.verifyHeader(chain, header, nil)
+	return wrapHeaderError(header, a.verifyHeader(context.Background(), chain, header, nil))
 }
 
 // VerifyHeaders is similar to VerifyHeader, but verifies a batch of headers. The
 // method returns a quit channel to abort the operations and a results channel to
 // retrieve the async verifications (the order is that of the input slice).
+// Aborting also cancels any governance lookup the verifications are waiting on.
 func (a *Atmos) VerifyHeaders(chain consensus.ChainReader, headers []*types.Header, seals []bool) (chan<- struct{}, <-chan error) {
 	abort := make(chan struct{})
 	results := make(chan error, len(headers))
+	if len(headers) == 0 {
+		return abort, results
+	}
+	// Added by Aerum
+	// Headers relying on the same epoch snapshot are verified sequentially to reuse
+	// the snapshots built by their predecessors, but distinct epochs in parallel
+	segments := a.verifySegments(headers)
 
-	go func() {
-		for i, header := range headers {
-			err := a.verifyHeader(chain, header, headers[:i])
+	workers := runtime.NumCPU()
+	if len(segments) < workers {
+		workers = len(segments)
+	}
+	var (
+		inputs = make(chan int)
+		done   = make(chan int, len(headers))
+		errs   = make([]error, len(headers))
 
+		ctx, cancel = context.WithCancel(context.Background())
+	)
+	for i := 0; i < workers; i++ {
+		go func() {
+			for segment := range inputs {
+				for index := segments[segment][0]; index < segments[segment][1]; index++ {
+					select {
+					case <-abort:
+						return
+					default:
+					}
+					errs[index] = wrapHeaderError(headers[index], a.verifyHeader(ctx, chain, headers[index], headers[:index]))
+					done <- index
+				}
+			}
+		}()
+	}
+	go func() {
+		defer close(inputs)
+		defer cancel()
+		var (
+			in, out = 0, 0
+			checked = make([]bool, len(headers))
+			inputs  = inputs
+		)
+		for {
 			select {
+			case inputs <- in:
+				if in++; in == len(segments) {
+					// Reached end of segments. Stop sending to workers.
+					inputs = nil
+				}
+			case index := <-done:
+				for checked[index] = true; out < len(headers) && checked[out]; out++ {
+					results <- errs[out]
+				}
+				if out == len(headers) {
+					return
+				}
 			case <-abort:
 				return
-			case results <- err:
 			}
 		}
 	}()
 	return abort, results
 }
 
+// Added by Aerum
+// verifySegments splits a batch of headers into consecutive [start, end) index
+// ranges, each range containing the headers verified against snapshots derived
+// from the same epoch checkpoint. Dependencies between headers break at these
+// boundaries, so the ranges can be verified concurrently.
+func (a *Atmos) verifySegments(headers []*types.Header) [][2]int {
+	// epoch returns the checkpoint the snapshot verifying a header is based on,
+	// or false if the header can't be associated with one (genesis, malformed)
+	epoch := func(header *types.Header) (uint64, bool) {
+		if header.Number == nil || header.Number.Sign() == 0 {
+			return 0, false
+		}
+		return (header.Number.Uint64() - 1) / a.config.Epoch, true
+	}
+	var segments [][2]int
+	for i := range headers {
+		if i > 0 {
+			prev, pok := epoch(headers[i-1])
+			next, nok := epoch(headers[i])
+			if pok && nok && prev == next {
+				segments[len(segments)-1][1] = i + 1
+				continue
+			}
+		}
+		segments = append(segments, [2]int{i, i + 1})
+	}
+	return segments
+}
+
 // verifyHeader checks whether a header conforms to the consensus rules.The
 // caller may optionally pass in a batch of parents (ascending order) to avoid
 // looking those up from the database. This is useful for concurrently verifying
-// a batch of new headers.
-func (a *Atmos) verifyHeader(chain consensus.ChainReader, header *types.Header, parents []*types.Header) error {
+// a batch of new headers. Any governance lookup needed is aborted once the
+// context is cancelled.
+func (a *Atmos) verifyHeader(ctx context.Context, chain consensus.ChainReader, header *types.Header, parents []*types.Header) error {
 	if header.Number == nil {
 		return errUnknownBlock
 	}
+	// Added by Aerum
+	// Run the standalone checks, bailing out at the first violation
+	for _, check := range standaloneChecks {
+		if err := check(a, chain, header); err != nil {
+			return err
+		}
+	}
+	// All basic checks passed, verify cascading fields
+	return a.verifyCascadingFields(ctx, chain, header, parents)
+}
+
+// Added by Aerum
+// VerifyHeaderVerbose runs the same checks as VerifyHeader, but instead of failing
+// at the first violation, it accumulates every problem found with the header. It
+// is meant for auditing tools and does not cache the header as verified.
+//
+// Checks depending on a failed prerequisite (e.g. an unknown parent or missing
+// snapshot) are skipped, as their results would be meaningless.
+func (a *Atmos) VerifyHeaderVerbose(chain consensus.ChainReader, header *types.Header) []error {
+	if header.Number == nil {
+		return []error{errUnknownBlock}
+	}
+	var errs []error
+	for _, check := range standaloneChecks {
+		if err := check(a, chain, header); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	// The genesis block is the always valid dead-end
 	number := header.Number.Uint64()
+	if number == 0 {
+		return errs
+	}
+	parent := getParentHeader(chain, header, nil)
+	if parent == nil {
+		return append(errs, consensus.ErrUnknownAncestor)
+	}
+	if err := a.checkParentTime(parent, header); err != nil {
+		errs = append(errs, err)
+	}
+	snap, err := a.snapshot(chain, number-1, header.ParentHash, nil)
+	if err != nil {
+		return append(errs, err)
+	}
+	// Signer list and seal checks need well formed extra-data to operate on
+	if checkExtraData(a, chain, header) != nil {
+		return errs
+	}
+	if number%a.config.Epoch == 0 {
+		if err := a.checkCheckpointSigners(snap, header); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	signer, err := ecrecover(header, a.signatures, a.sealHashes)
+	if err != nil {
+		return append(errs, err)
+	}
+	if err := checkAuthorized(snap, signer); err != nil {
+		errs = append(errs, err)
+	}
+	if err := a.checkRecents(chain, snap, header, nil, signer); err != nil {
+		errs = append(errs, err)
+	}
+	// A meaningless difficulty is already reported, its turn-ness would only duplicate it
+	if checkDifficulty(a, chain, header) == nil {
+		if err := a.checkTurnDifficulty(snap, header, signer); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
 
-	// Don't waste time checking blocks from the future
-	if header.Time > uint64(time.Now().Unix()) {
+// Added by Aerum
+// headerCheck is a standalone header validity rule, not depending on any other
+// header. The rules are shared between the failing and the verbose verification.
+type headerCheck func(a *Atmos, chain consensus.ChainReader, header *types.Header) error
+
+// standaloneChecks are the standalone header rules in the order they're enforced.
+var standaloneChecks = []headerCheck{
+	checkFutureBlock,
+	checkCheckpointBeneficiary,
+	checkExtraData,
+	checkMixDigest,
+	checkUncleHash,
+	checkDifficulty,
+	checkForkHashes,
+}
+
+// checkFutureBlock ensures we don't waste time checking blocks from the future,
+// tolerating the clock skew allowed by the chain config.
+func checkFutureBlock(a *Atmos, chain consensus.ChainReader, header *types.Header) error {
+	if header.Time > uint64(a.clock().Add(a.config.AllowedFutureDrift).Unix()) {
 		return consensus.ErrFutureBlock
 	}
-	// Checkpoint blocks need to enforce zero beneficiary
-	checkpoint := (number % a.config.Epoch) == 0
-	if checkpoint && header.Coinbase != (common.Address{}) {
+	return nil
+}
+
+// checkCheckpointBeneficiary ensures checkpoint blocks have a zero beneficiary.
+func checkCheckpointBeneficiary(a *Atmos, chain consensus.ChainReader, header *types.Header) error {
+	if header.Number.Uint64()%a.config.Epoch == 0 && header.Coinbase != (common.Address{}) {
 		return errInvalidCheckpointBeneficiary
 	}
-	// Check that the extra-data contains both the vanity and signature
+	return nil
+}
+
+// checkExtraData ensures the extra-data contains both the vanity and signature,
+// as well as a signer list on checkpoints, but none otherwise.
+func checkExtraData(a *Atmos, chain consensus.ChainReader, header *types.Header) error {
 	if len(header.Extra) < extraVanity {
 		return errMissingVanity
 	}
 	if len(header.Extra) < extraVanity+extraSeal {
 		return errMissingSignature
 	}
-	// Ensure that the extra-data contains a signer list on checkpoint, but none otherwise
+	checkpoint := header.Number.Uint64()%a.config.Epoch == 0
+
 	signersBytes := len(header.Extra) - extraVanity - extraSeal
 	if !checkpoint && signersBytes != 0 {
 		return errExtraSigners
@@ -272,33 +716,53 @@ func (a *Atmos) verifyHeader(chain consensus.ChainReader, header *types.Header,
 	if checkpoint && signersBytes%common.AddressLength != 0 {
 		return errInvalidCheckpointSigners
 	}
-	// Ensure that the mix digest is zero as we don't have fork protection currently
+	// Added by Aerum
+	// Committees are capped, reject oversized signer lists before comparing them
+	if checkpoint && a.strictRules(header.Number.Uint64()) && signersBytes/common.AddressLength > a.config.SignersPerEpoch {
+		return errInvalidCheckpointSigners
+	}
+	return nil
+}
+
+// checkMixDigest ensures that the mix digest is zero as we don't have fork
+// protection currently.
+func checkMixDigest(a *Atmos, chain consensus.ChainReader, header *types.Header) error {
 	if header.MixDigest != (common.Hash{}) {
 		return errInvalidMixDigest
 	}
-	// Ensure that the block doesn't contain any uncles which are meaningless in PoA
+	return nil
+}
+
+// checkUncleHash ensures that the block doesn't contain any uncles which are
+// meaningless in PoA.
+func checkUncleHash(a *Atmos, chain consensus.ChainReader, header *types.Header) error {
 	if header.UncleHash != uncleHash {
 		return errInvalidUncleHash
 	}
-	// Ensure that the block's difficulty is meaningful (may not be correct at this point)
-	if number > 0 {
-		if header.Difficulty == nil || (header.Difficulty.Cmp(diffInTurn) != 0 && header.Difficulty.Cmp(diffNoTurn) != 0) {
+	return nil
+}
+
+// checkDifficulty ensures that the block's difficulty is meaningful (may not be
+// correct at this point).
+func checkDifficulty(a *Atmos, chain consensus.ChainReader, header *types.Header) error {
+	if header.Number.Uint64() > 0 {
+		if header.Difficulty == nil || (header.Difficulty.Cmp(turnDifficulty(a.config, true)) != 0 && header.Difficulty.Cmp(turnDifficulty(a.config, false)) != 0) {
 			return errInvalidDifficulty
 		}
 	}
-	// If all checks passed, validate any special fields for hard forks
-	if err := misc.VerifyForkHashes(chain.Config(), header, false); err != nil {
-		return err
-	}
-	// All basic checks passed, verify cascading fields
-	return a.verifyCascadingFields(chain, header, parents)
+	return nil
+}
+
+// checkForkHashes validates any special fields for hard forks.
+func checkForkHashes(a *Atmos, chain consensus.ChainReader, header *types.Header) error {
+	return misc.VerifyForkHashes(chain.Config(), header, false)
 }
 
 // verifyCascadingFields verifies all the header fields that are not standalone,
 // rather depend on a batch of previous headers. The caller may optionally pass
 // in a batch of parents (ascending order) to avoid looking those up from the
 // database. This is useful for concurrently verifying a batch of new headers.
-func (a *Atmos) verifyCascadingFields(chain consensus.ChainReader, header *types.Header, parents []*types.Header) error {
+func (a *Atmos) verifyCascadingFields(ctx context.Context, chain consensus.ChainReader, header *types.Header, parents []*types.Header) error {
 	// The genesis block is the always valid dead-end
 	number := header.Number.Uint64()
 	if number == 0 {
@@ -309,42 +773,133 @@ func (a *Atmos) verifyCascadingFields(chain consensus.ChainReader, header *types
 	if parent == nil {
 		return consensus.ErrUnknownAncestor
 	}
-	if parent.Time+a.config.Period > header.Time {
-		return ErrInvalidTimestamp
+	if err := a.checkParentTime(parent, header); err != nil {
+		return err
 	}
 	// Retrieve the snapshot needed to verify this header and cache it
-	snap, err := a.snapshot(chain, number-1, header.ParentHash, parents)
+	snap, err := a.snapshotCtx(ctx, chain, number-1, header.ParentHash, parents)
 	if err != nil {
 		return err
 	}
 	// If the block is a checkpoint block, verify the signer list
 	if number%a.config.Epoch == 0 {
-		signers := make([]byte, len(snap.Signers)*common.AddressLength)
-		for i, signer := range snap.signers() {
-			copy(signers[i*common.AddressLength:], signer[:])
-		}
-		extraSuffix := len(header.Extra) - extraSeal
-		if !bytes.Equal(header.Extra[extraVanity:extraSuffix], signers) {
-			return errMismatchingCheckpointSigners
+		if err := a.checkCheckpointSigners(snap, header); err != nil {
+			return err
 		}
 	}
 	// All basic checks passed, verify the seal and return
-	return a.verifySeal(chain, header, parents)
+	return a.verifySeal(ctx, chain, header, parents)
+}
+
+// Added by Aerum
+// checkParentTime ensures that the block's timestamp isn't too close to it's parent.
+func (a *Atmos) checkParentTime(parent *types.Header, header *types.Header) error {
+	if parent.Time+a.blockPeriod(header.Number.Uint64()) > header.Time {
+		return ErrInvalidTimestamp
+	}
+	return nil
+}
+
+// Added by Aerum
+// blockPeriod returns the minimum time difference between the given block and its
+// parent, which is the bootstrap period for the first blocks of the chain. Past
+// the strict rules block, a zero period is only honoured in dev mode.
+func (a *Atmos) blockPeriod(number uint64) uint64 {
+	if number <= a.config.BootstrapFastBlocks {
+		return a.config.BootstrapFastPeriod
+	}
+	if a.config.Period == 0 && !a.config.DevMode && a.strictRules(number) {
+		return params.NewAtmosBlockInterval()
+	}
+	return a.config.Period
+}
+
+// Added by Aerum
+// strictRules returns whether the stricter checkpoint, period and recents rules
+// apply to the given block. Blocks before the activation keep the original ones,
+// so the historical chain stays valid.
+func (a *Atmos) strictRules(number uint64) bool {
+	return a.config.IsStrictRules(new(big.Int).SetUint64(number))
+}
+
+// Added by Aerum
+// minSigners returns the minimum number of signers a committee taking effect at
+// the given block must consist of.
+func (a *Atmos) minSigners(number uint64) int {
+	if !a.strictRules(number) {
+		return 0
+	}
+	return a.config.MinSigners
+}
+
+// Added by Aerum
+// checkCheckpointSigners ensures that the signer list of a checkpoint block is
+// large enough and matches the signers of the snapshot preceding it.
+func (a *Atmos) checkCheckpointSigners(snap *Snapshot, header *types.Header) error {
+	// Reject committees too small to keep the recent-signer math live
+	if (len(header.Extra)-extraVanity-extraSeal)/common.AddressLength < a.minSigners(header.Number.Uint64()) {
+		return errInvalidNumberOfSigners
+	}
+	signers := make([]byte, len(snap.Signers)*common.AddressLength)
+	for i, signer := range snap.signers() {
+		copy(signers[i*common.AddressLength:], signer[:])
+	}
+	extraSuffix := len(header.Extra) - extraSeal
+	if !bytes.Equal(header.Extra[extraVanity:extraSuffix], signers) {
+		return errMismatchingCheckpointSigners
+	}
+	return nil
+}
+
+// Added by Aerum
+// checkpointSigners extracts the signer list embedded into the extra-data of a
+// checkpoint header, returning nil if the extra-data can't even hold a seal.
+func checkpointSigners(header *types.Header) []common.Address {
+	if len(header.Extra) < extraVanity+extraSeal {
+		return nil
+	}
+	signers := make([]common.Address, (len(header.Extra)-extraVanity-extraSeal)/common.AddressLength)
+	for i := 0; i < len(signers); i++ {
+		copy(signers[i][:], header.Extra[extraVanity+i*common.AddressLength:])
+	}
+	return signers
 }
 
 // snapshot retrieves the authorization snapshot at a given point in time.
 func (a *Atmos) snapshot(chain consensus.ChainReader, number uint64, hash common.Hash, parents []*types.Header) (*Snapshot, error) {
+	return a.snapshotCtx(context.Background(), chain, number, hash, parents)
+}
+
+// Added by Aerum
+// snapshotCtx retrieves the authorization snapshot at a given point in time,
+// aborting the backward header walk and any governance lookup once the context
+// is cancelled.
+func (a *Atmos) snapshotCtx(ctx context.Context, chain consensus.ChainReader, number uint64, hash common.Hash, parents []*types.Header) (*Snapshot, error) {
+	// Don't reach out to disk or governance once the engine is torn down
+	if a.ctx.Err() != nil {
+		return nil, errEngineClosed
+	}
 	// Search for a snapshot in memory or on disk for checkpoints
 	var (
 		headers []*types.Header
 		snap    *Snapshot
 	)
 	for snap == nil {
+		// Added by Aerum
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 		// If an in-memory snapshot was found, use that
 		if s, ok := a.recents.Get(hash); ok {
 			snap = s.(*Snapshot)
+			if len(headers) == 0 {
+				snapshotHitCounter.Inc(1)
+			}
 			break
 		}
+		if len(headers) == 0 {
+			snapshotMissCounter.Inc(1)
+		}
 		// If we're at the genesis, snapshot the initial state. Alternatively if we're
 		// at a checkpoint block without a parent (light client CHT), or we have piled
 		// up more headers than allowed to be reorged (chain reinit from a freezer),
@@ -354,9 +909,12 @@ func (a *Atmos) snapshot(chain consensus.ChainReader, number uint64, hash common
 			if checkpoint != nil {
 				hash := checkpoint.Hash()
 
-				signers := make([]common.Address, (len(checkpoint.Extra)-extraVanity-extraSeal)/common.AddressLength)
-				for i := 0; i < len(signers); i++ {
-					copy(signers[i][:], checkpoint.Extra[extraVanity+i*common.AddressLength:])
+				signers := checkpointSigners(checkpoint)
+
+				// Added by Aerum
+				if len(signers) < a.minSigners(number) {
+					log.Error("Checkpoint contains too few signers", "number", number, "hash", hash, "signers", len(signers), "min", a.minSigners(number))
+					return nil, errInvalidNumberOfSigners
 				}
 				snap = newSnapshot(a.config, a.signatures, number, hash, signers)
 				if err := snap.store(a.db); err != nil {
@@ -374,20 +932,53 @@ func (a *Atmos) snapshot(chain consensus.ChainReader, number uint64, hash common
 				snap = s
 				break
 			}
-			// If snapshot not found in db load it from governance contract
-			signers, err := getComposers(chain, a.config, number, parents)
-			if err != nil {
-				log.Error("Loaded snapshot from governance contract failed", "number", number, "hash", hash, "error", err)
-				return nil, err
+			// Trusted checkpoints take precedence over governance, letting light
+			// clients sync without an Ethereum endpoint
+			if signers, ok := a.config.TrustedCheckpoints[number/a.config.Epoch]; ok {
+				if len(signers) < a.minSigners(number) {
+					log.Error("Trusted checkpoint contains too few signers", "number", number, "hash", hash, "signers", len(signers), "min", a.minSigners(number))
+					return nil, errInvalidNumberOfSigners
+				}
+				log.Trace("Loaded snapshot from trusted checkpoint", "number", number, "hash", hash)
+				snap = newSnapshot(a.config, a.signatures, number, hash, signers)
+
+				if a.strictRules(number) {
+					limit := uint64(len(snap.Signers)/2 + 1)
+					if err := snap.seedRecents(recentHeaders(chain, parents, number, hash, limit)); err != nil {
+						return nil, err
+					}
+				}
+				break
 			}
-			// Check number of signers returned from governance contract
-			if len(signers) == 0 {
-				log.Error("Loaded snapshot from governance contract contains no signers", "number", number, "hash", hash, "error", err)
-				return nil, errInvalidNumberOfSigners
+			// If snapshot not found in db load it from governance contract, unless the
+			// signers are static, in which case they are carried over from the parent
+			if !a.config.StaticSigners {
+				signers, err := a.epochSigners(ctx, chain, number, parents)
+				if err != nil {
+					log.Error("Loaded snapshot from governance contract failed", "number", number, "hash", hash, "error", err)
+					if signers = a.graceSigners(ctx, chain, number, hash, parents); signers == nil {
+						return nil, err
+					}
+				}
+				// Check number of signers returned from governance contract
+				if len(signers) == 0 || len(signers) < a.minSigners(number) {
+					log.Error("Loaded snapshot from governance contract contains too few signers", "number", number, "hash", hash, "signers", len(signers), "min", a.minSigners(number))
+					return nil, errInvalidNumberOfSigners
+				}
+				log.Trace("Loaded snapshot from governance contract", "number", number, "hash", hash)
+				snap = newSnapshot(a.config, a.signatures, number, hash, signers)
+
+				// Recover the recent signers as replaying the headers would have, so
+				// spam protection doesn't depend on how the snapshot was assembled
+				if a.strictRules(number) {
+					limit := uint64(len(snap.Signers)/2 + 1)
+					if err := snap.seedRecents(recentHeaders(chain, parents, number, hash, limit)); err != nil {
+						return nil, err
+					}
+				}
+				a.notifySignersChanged(chain, snap, parents)
+				break
 			}
-			log.Trace("Loaded snapshot from governance contract", "number", number, "hash", hash)
-			snap = newSnapshot(a.config, a.signatures, number, hash, signers)
-			break
 		}
 		// No snapshot for this header, gather the header and move backward
 		var header *types.Header
@@ -408,6 +999,13 @@ func (a *Atmos) snapshot(chain consensus.ChainReader, number uint64, hash common
 		headers = append(headers, header)
 		number, hash = number-1, header.ParentHash
 	}
+	// Added by Aerum
+	// Walking back this far means a checkpoint snapshot is missing from the
+	// database, flag it as it hints at pruning or corruption
+	if uint64(len(headers)) > a.config.SnapshotWalkWarnDepth {
+		log.Warn("Snapshot lookup walked back deep", "from", headers[0].Number, "to", snap.Number, "headers", len(headers), "threshold", a.config.SnapshotWalkWarnDepth)
+		snapshotDeepWalkCounter.Inc(1)
+	}
 	// Previous snapshot found, apply any pending headers on top of it
 	for i := 0; i < len(headers)/2; i++ {
 		headers[i], headers[len(headers)-1-i] = headers[len(headers)-1-i], headers[i]
@@ -429,6 +1027,49 @@ func (a *Atmos) snapshot(chain consensus.ChainReader, number uint64, hash common
 	return snap, err
 }
 
+// Added by Aerum
+// notifySignersChanged invokes the registered committee rotation hook if the
+// signers of the freshly built epoch snapshot differ from those of its parent.
+// The parent snapshot is only consulted if it's readily available in memory.
+func (a *Atmos) notifySignersChanged(chain consensus.ChainReader, snap *Snapshot, parents []*types.Header) {
+	a.lock.RLock()
+	fn := a.onSignersChanged
+	a.lock.RUnlock()
+
+	if fn == nil || snap.Number == 0 {
+		return
+	}
+	// Resolve the parent of the epoch block to find the previous committee
+	var header *types.Header
+	if len(parents) > 0 && parents[len(parents)-1].Hash() == snap.Hash {
+		header = parents[len(parents)-1]
+	} else if chain != nil {
+		header = chain.GetHeader(snap.Hash, snap.Number)
+	}
+	if header == nil {
+		return
+	}
+	prev, ok := a.recents.Get(header.ParentHash)
+	if !ok {
+		return
+	}
+	old, new := prev.(*Snapshot).signers(), snap.signers()
+	if len(old) == len(new) {
+		same := true
+		for i := range old {
+			if old[i] != new[i] {
+				same = false
+				break
+			}
+		}
+		if same {
+			return
+		}
+	}
+	log.Info("Atmos signer committee rotated", "number", snap.Number, "old", len(old), "new", len(new))
+	fn(snap.Number, old, new)
+}
+
 // VerifyUncles implements consensus.Engine, always returning an error for any
 // uncles as this consensus mechanism doesn't permit uncles.
 func (a *Atmos) VerifyUncles(chain consensus.ChainReader, block *types.Block) error {
@@ -441,75 +1082,122 @@ func (a *Atmos) VerifyUncles(chain consensus.ChainReader, block *types.Block) er
 // VerifySeal implements consensus.Engine, checking whether the signature contained
 // in the header satisfies the consensus protocol requirements.
 func (a *Atmos) VerifySeal(chain consensus.ChainReader, header *types.Header) error {
-	return a.verifySeal(chain, header, nil)
+	return wrapHeaderError(header, a.verifySeal(context.Background(), chain, header, nil))
 }
 
 // verifySeal checks whether the signature contained in the header satisfies the
 // consensus protocol requirements. The method accepts an optional list of parent
 // headers that aren't yet part of the local blockchain to generate the snapshots
 // from.
-func (a *Atmos) verifySeal(chain consensus.ChainReader, header *types.Header, parents []*types.Header) error {
+func (a *Atmos) verifySeal(ctx context.Context, chain consensus.ChainReader, header *types.Header, parents []*types.Header) error {
 	// Verifying the genesis block is not supported
 	number := header.Number.Uint64()
 	if number == 0 {
 		return errUnknownBlock
 	}
 	// Retrieve the snapshot needed to verify this header and cache it
-	snap, err := a.snapshot(chain, number-1, header.ParentHash, parents)
+	snap, err := a.snapshotCtx(ctx, chain, number-1, header.ParentHash, parents)
 	if err != nil {
 		return err
 	}
 
 	// Resolve the authorization key and check against signers
-	signer, err := ecrecover(header, a.signatures)
+	signer, err := ecrecover(header, a.signatures, a.sealHashes)
 	if err != nil {
 		return err
 	}
-	if _, ok := snap.Signers[signer]; !ok {
-		return errUnauthorizedSigner
+	if err := checkAuthorized(snap, signer); err != nil {
+		log.Error("Rejected block from unauthorized signer", "number", number, "hash", header.Hash(), "signer", signer, "signers", len(snap.Signers))
+		log.Debug("Authorized Atmos signers", "number", number, "signers", snap.signers())
+		return err
 	}
-
-	// NOTE: To be removed by Aerum. Disable recents updates for now
-	for seen, recent := range snap.Recents {
-		if recent == signer {
-			// Signer is among recents, only fail if the current block doesn't shift it out
-			if limit := uint64(len(snap.Signers)/2 + 1); seen > number-limit {
-				return errRecentlySigned
-			}
-		}
+	if err := a.checkRecents(chain, snap, header, parents, signer); err != nil {
+		return err
+	}
+	// Added by Aerum
+	// Explorers display the coinbase as the block producer, make sure it is one
+	if a.config.EnforceCoinbaseIsSigner && number%a.config.Epoch != 0 && header.Coinbase != signer {
+		return errCoinbaseNotSigner
 	}
-
-	//  NOTE: Added by Aerum. Disable recents updates for now
-	//	for seen, recent := range snap.Recents {
-	//		if recent == signer {
-	//			// Signer is among recents, only fail if the current block doesn't shift it out
-	//			if limit := uint64(len(snap.Signers)/2 + 1); seen > number-limit {
-	//				// Ensure that the block's timestamp isn't too close to it's parent if it's recent
-	//				parent := getParentHeader(chain, header, parents)
-	//				if parent == nil {
-	//					return consensus.ErrUnknownAncestor
-	//				}
-	//				if parent.Time+uint64(recentsTimeout.Seconds()) > header.Time {
-	//					log.Error("Invalid block time. Recent signer is trying to sign block too fast", "parent time", parent.Time, "block time", header.Time, "block number", header.Number)
-	//					return ErrInvalidTimestamp
-	//				}
-	//			}
-	//		}
-	//	}
-
 	// Ensure that the difficulty corresponds to the turn-ness of the signer
-	if !a.fakeDiff {
-		inturn := snap.inturn(header.Number.Uint64(), signer)
-		if inturn && header.Difficulty.Cmp(diffInTurn) != 0 {
-			return errWrongDifficulty
+	return a.checkTurnDifficulty(snap, header, signer)
+}
+
+// Added by Aerum
+// VerifySealAgainstSigners checks that the header was sealed by one of the given
+// trusted signers, typically taken from a trusted checkpoint.
+//
+// Note, this is a reduced-security check meant for light clients unable to
+// rebuild the snapshots needed by VerifySeal: neither the recent signer limits
+// nor the turn-ness of the difficulty are verified.
+func (a *Atmos) VerifySealAgainstSigners(header *types.Header, trustedSigners []common.Address) error {
+	if header.Number.Uint64() == 0 {
+		return errUnknownBlock
+	}
+	signer, err := ecrecover(header, a.signatures, a.sealHashes)
+	if err != nil {
+		return err
+	}
+	for _, trusted := range trustedSigners {
+		if signer == trusted {
+			return nil
 		}
-		if !inturn && header.Difficulty.Cmp(diffNoTurn) != 0 {
-			return errWrongDifficulty
+	}
+	verifyUnauthorizedCounter.Inc(1)
+	return errUnauthorizedSigner
+}
+
+// Added by Aerum
+// checkAuthorized ensures that the signer is amongst the authorized ones.
+func checkAuthorized(snap *Snapshot, signer common.Address) error {
+	if _, ok := snap.Signers[signer]; !ok {
+		verifyUnauthorizedCounter.Inc(1)
+		return errUnauthorizedSigner
+	}
+	return nil
+}
+
+// Added by Aerum
+// checkRecents ensures that the signer didn't sign too recently, or if recent
+// signers are allowed to seal after a timeout, that the timeout has passed.
+func (a *Atmos) checkRecents(chain consensus.ChainReader, snap *Snapshot, header *types.Header, parents []*types.Header, signer common.Address) error {
+	number := header.Number.Uint64()
+	for seen, recent := range snap.Recents {
+		if recent == signer {
+			// Signer is among recents, only fail if the current block doesn't shift it out
+			if limit := uint64(len(snap.Signers)/2 + 1); seen > number-limit {
+				if !a.config.EnforceRecentTimeout {
+					verifyRecentCounter.Inc(1)
+					return errRecentlySigned
+				}
+				// Recent signers are allowed to seal, but only after the recents timeout
+				parent := getParentHeader(chain, header, parents)
+				if parent == nil {
+					return consensus.ErrUnknownAncestor
+				}
+				if parent.Time+uint64(a.config.RecentsTimeout/time.Second) > header.Time {
+					log.Error("Invalid block time. Recent signer is trying to sign block too fast", "parent time", parent.Time, "block time", header.Time, "block number", header.Number)
+					return ErrInvalidTimestamp
+				}
+			}
 		}
 	}
 	return nil
 }
 
+// Added by Aerum
+// checkTurnDifficulty ensures that the difficulty corresponds to the turn-ness
+// of the signer.
+func (a *Atmos) checkTurnDifficulty(snap *Snapshot, header *types.Header, signer common.Address) error {
+	if a.fakeDiff {
+		return nil
+	}
+	if header.Difficulty.Cmp(turnDifficulty(a.config, snap.inturn(header.Number.Uint64(), signer))) != 0 {
+		return errWrongDifficulty
+	}
+	return nil
+}
+
 // Prepare implements consensus.Engine, preparing all the consensus fields of the
 // header for running the transactions on top.
 func (a *Atmos) Prepare(chain consensus.ChainReader, header *types.Header) error {
@@ -518,14 +1206,51 @@ func (a *Atmos) Prepare(chain consensus.ChainReader, header *types.Header) error
 	header.Nonce = types.BlockNonce{}
 
 	number := header.Number.Uint64()
+	parent := chain.GetHeader(header.ParentHash, number-1)
+	if parent == nil {
+		return consensus.ErrUnknownAncestor
+	}
+	// Set the correct difficulty
+	difficulty, err := a.calcDifficulty(chain, parent)
+	if err != nil {
+		return err
+	}
+	header.Difficulty = difficulty
+
 	// Assemble the voting snapshot to check which votes make sense
 	snap, err := a.snapshot(chain, number-1, header.ParentHash, nil)
 	if err != nil {
 		return err
 	}
-
-	// Set the correct difficulty
-	header.Difficulty = CalcDifficulty(snap, a.signer)
+	// Added by Aerum
+	// Chains enforcing the coinbase to be the signer can't vote via the coinbase,
+	// whereas otherwise local proposals are only voted on if explicitly allowed by
+	// the operator
+	if a.config.EnforceCoinbaseIsSigner && number%a.config.Epoch != 0 {
+		a.lock.RLock()
+		header.Coinbase = a.signer
+		a.lock.RUnlock()
+	} else if a.config.AllowLocalProposals && number%a.config.Epoch != 0 {
+		a.lock.RLock()
+
+		// Gather all the proposals that make sense voting on
+		addresses := make([]common.Address, 0, len(a.proposals))
+		for address, authorize := range a.proposals {
+			if snap.validVote(address, authorize) {
+				addresses = append(addresses, address)
+			}
+		}
+		// If there's pending proposals, cast a vote on them
+		if len(addresses) > 0 {
+			header.Coinbase = addresses[rand.Intn(len(addresses))]
+			if a.proposals[header.Coinbase] {
+				copy(header.Nonce[:], nonceAuthVote)
+			} else {
+				copy(header.Nonce[:], nonceDropVote)
+			}
+		}
+		a.lock.RUnlock()
+	}
 
 	// Ensure the extra data has all it's components
 	if len(header.Extra) < extraVanity {
@@ -533,6 +1258,15 @@ func (a *Atmos) Prepare(chain consensus.ChainReader, header *types.Header) error
 	}
 	header.Extra = header.Extra[:extraVanity]
 
+	// Added by Aerum
+	// Replace the vanity with the configured one (into a fresh slice, the original
+	// extra-data might be shared with the caller)
+	if len(a.config.Vanity) > 0 {
+		vanity := make([]byte, extraVanity)
+		copy(vanity, a.config.Vanity)
+		header.Extra = vanity
+	}
+
 	if number%a.config.Epoch == 0 {
 		for _, signer := range snap.signers() {
 			header.Extra = append(header.Extra, signer[:]...)
@@ -544,23 +1278,51 @@ func (a *Atmos) Prepare(chain consensus.ChainReader, header *types.Header) error
 	header.MixDigest = common.Hash{}
 
 	// Ensure the timestamp has the correct delay
-	parent := chain.GetHeader(header.ParentHash, number-1)
-	if parent == nil {
-		return consensus.ErrUnknownAncestor
-	}
-	header.Time = parent.Time + a.config.Period
-	if header.Time < uint64(time.Now().Unix()) {
-		header.Time = uint64(time.Now().Unix())
+	header.Time = a.prepareTime(parent)
+	// Added by Aerum
+	// If we're amongst the recent signers, push the block out until the recents timeout passes
+	if a.config.EnforceRecentTimeout {
+		a.lock.RLock()
+		signer := a.signer
+		a.lock.RUnlock()
+
+		if snap.recentlySigned(number, signer) {
+			if timeout := parent.Time + uint64(a.config.RecentsTimeout/time.Second); header.Time < timeout {
+				header.Time = timeout
+			}
+		}
 	}
 	return nil
 }
 
+// prepareTime calculates the timestamp of a block being built on top of parent,
+// respecting the block period, but never going back before the current time.
+func (a *Atmos) prepareTime(parent *types.Header) uint64 {
+	// Added by Aerum
+	// Zero period (dev mode) blocks must still strictly follow their parent, as
+	// duplicate timestamps would be rejected by other nodes
+	period := a.blockPeriod(parent.Number.Uint64() + 1)
+	if period == 0 {
+		period = 1
+	}
+	timestamp := parent.Time + period
+	if now := uint64(a.clock().Unix()); timestamp < now {
+		timestamp = now
+	}
+	return timestamp
+}
+
 // Finalize implements consensus.Engine, ensuring no uncles are set, nor block
 // rewards given.
 func (a *Atmos) Finalize(chain consensus.ChainReader, header *types.Header, state *state.StateDB, txs []*types.Transaction, uncles []*types.Header) {
 	// Added by Aerum
-	// Accumulate any block rewards and commit the final state root
-	accumulateRewards(a, state, header)
+	// Accumulate any block rewards to the sealer and commit the final state root. A
+	// block without a valid seal doesn't reward anyone, failing its state root check.
+	if signer, err := ecrecover(header, a.signatures, a.sealHashes); err != nil {
+		log.Error("Failed to recover block signer, skipping reward", "number", header.Number, "hash", header.Hash(), "err", err)
+	} else {
+		accumulateRewards(a, state, header, signer)
+	}
 
 	header.Root = state.IntermediateRoot(chain.Config().IsEIP158(header.Number))
 	header.UncleHash = types.CalcUncleHash(nil)
@@ -570,8 +1332,13 @@ func (a *Atmos) Finalize(chain consensus.ChainReader, header *types.Header, stat
 // nor block rewards given, and returns the final block.
 func (a *Atmos) FinalizeAndAssemble(chain consensus.ChainReader, header *types.Header, state *state.StateDB, txs []*types.Transaction, uncles []*types.Header, receipts []*types.Receipt) (*types.Block, error) {
 	// Added by Aerum
-	// Accumulate any block rewards and commit the final state root
-	accumulateRewards(a, state, header)
+	// Accumulate any block rewards to the local signer who is about to seal the
+	// block and commit the final state root
+	a.lock.RLock()
+	signer := a.signer
+	a.lock.RUnlock()
+
+	accumulateRewards(a, state, header, signer)
 
 	header.Root = state.IntermediateRoot(chain.Config().IsEIP158(header.Number))
 	header.UncleHash = types.CalcUncleHash(nil)
@@ -590,20 +1357,81 @@ func (a *Atmos) Authorize(signer common.Address, signFn SignerFn) {
 	a.signFn = signFn
 }
 
+// Added by Aerum
+// SetComposerSource replaces the source epoch signers are loaded from, which is
+// the governance contract by default. Signers already cached are not affected.
+func (a *Atmos) SetComposerSource(source ComposerSource) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	a.source = source
+}
+
+// Added by Aerum
+// OnSignersChanged registers a callback to be invoked whenever an epoch snapshot
+// is built with a signer committee different from the previous epoch's. Passing
+// nil removes any previously registered callback.
+func (a *Atmos) OnSignersChanged(fn SignersChangedFn) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	a.onSignersChanged = fn
+}
+
 // Seal implements consensus.Engine, attempting to create a sealed block using
 // the local signing credentials.
 func (a *Atmos) Seal(chain consensus.ChainReader, block *types.Block, results chan<- *types.Block, stop <-chan struct{}) error {
+	sealed, delay, err := a.seal(chain, block)
+	if err != nil || sealed == nil {
+		return err
+	}
+	// Wait until sealing is terminated or delay timeout.
+	log.Trace("Waiting for slot to sign and propagate", "delay", common.PrettyDuration(delay))
+
+	go func() {
+		select {
+		case <-stop:
+			return
+		case <-time.After(delay):
+		}
+
+		select {
+		case results <- sealed:
+		default:
+			log.Warn("Sealing result is not read by miner", "sealhash", a.SealHash(sealed.Header()))
+		}
+	}()
+
+	return nil
+}
+
+// Added by Aerum
+// SealForTesting signs the block with the local signing credentials just like
+// Seal does, but instead of waiting to release it, returns the sealed block along
+// with the delay Seal would have waited for. A nil block is returned if sealing
+// is paused or the local signer has to wait for others.
+func (a *Atmos) SealForTesting(chain consensus.ChainReader, block *types.Block) (*types.Block, time.Duration, error) {
+	return a.seal(chain, block)
+}
+
+// Added by Aerum
+// seal signs the block with the local signing credentials, returning the sealed
+// block and how long to wait before releasing it, or a nil block if the local
+// signer can't seal it at this point.
+func (a *Atmos) seal(chain consensus.ChainReader, block *types.Block) (*types.Block, time.Duration, error) {
 	header := block.Header()
 
 	// Sealing the genesis block is not supported
 	number := header.Number.Uint64()
 	if number == 0 {
-		return errUnknownBlock
+		return nil, 0, errUnknownBlock
 	}
-	// For 0-period chains, refuse to seal empty blocks (no reward but would spin sealing)
-	if a.config.Period == 0 && len(block.Transactions()) == 0 {
+	// For 0-period chains, refuse to seal empty blocks (no reward but would spin sealing),
+	// unless the chain wants a heartbeat of empty blocks
+	empty := a.blockPeriod(number) == 0 && len(block.Transactions()) == 0
+	if empty && !a.config.AllowEmptyBlocks {
 		log.Info("Sealing paused, waiting for transactions")
-		return nil
+		return nil, 0, nil
 	}
 	// Don't hold the signer fields for the entire sealing procedure
 	a.lock.RLock()
@@ -613,105 +1441,137 @@ func (a *Atmos) Seal(chain consensus.ChainReader, block *types.Block, results ch
 	// Bail out if we're unauthorized to sign a block
 	snap, err := a.snapshot(chain, number-1, header.ParentHash, nil)
 	if err != nil {
-		return err
+		return nil, 0, err
 	}
 	if _, authorized := snap.Signers[signer]; !authorized {
-		return errUnauthorizedSigner
+		log.Error("Local signer not authorized to seal block", "number", number, "signer", signer, "signers", len(snap.Signers))
+		log.Debug("Authorized Atmos signers", "number", number, "signers", snap.signers())
+		return nil, 0, errUnauthorizedSigner
 	}
 
-	// NOTE: To be removed by Aerum. Disable recents updates for now
 	// If we're amongst the recent signers, wait for the next block
-	for seen, recent := range snap.Recents {
-		if recent == signer {
-			// Signer is among recents, only wait if the current block doesn't shift it out
-			if limit := uint64(len(snap.Signers)/2 + 1); number < limit || seen > number-limit {
-				log.Info("Signed recently, must wait for others")
-				return nil
-			}
-		}
+	recent := snap.recentlySigned(number, signer)
+	if recent && !a.config.EnforceRecentTimeout {
+		log.Info("Signed recently, must wait for others")
+		return nil, 0, nil
 	}
-
 	// Sweet, the protocol permits us to sign the block, wait for our time
-	delay := time.Unix(int64(header.Time), 0).Sub(time.Now()) // nolint: gosimple
-	if header.Difficulty.Cmp(diffNoTurn) == 0 {
-		// It's not our turn explicitly to sign, delay it a bit
-		wiggle := time.Duration(len(snap.Signers)/2+1) * wiggleTime
-		delay += time.Duration(rand.Int63n(int64(wiggle)))
-
-		log.Trace("Out-of-turn signing requested", "wiggle", common.PrettyDuration(wiggle))
+	delay := a.sealDelay(snap, header, recent)
+	if empty && delay < emptyBlockDelay {
+		delay = emptyBlockDelay
 	}
+
 	// Sign all the things!
 	sighash, err := signFn(accounts.Account{Address: signer}, accounts.MimetypeAtmos, AtmosRLP(header))
 	if err != nil {
-		return err
+		return nil, 0, err
 	}
 	copy(header.Extra[len(header.Extra)-extraSeal:], sighash)
-	// Wait until sealing is terminated or delay timeout.
-	log.Trace("Waiting for slot to sign and propagate", "delay", common.PrettyDuration(delay))
 
-	//  NOTE: Added by Aerum. Disable recents updates for now
-	//	for seen, recent := range snap.Recents {
-	//		if recent == signer {
-	//			// Signer is among recents, only wait if the current block doesn't shift it out
-	//			if limit := uint64(len(snap.Signers)/2 + 1); number < limit || seen > number-limit {
-	//
-	//				// It's not our turn explicitly to sign, delay it a bit
-	//				wiggle := time.Duration(len(snap.Signers)/2+1) * wiggleTime
-	//				delay = recentsTimeout + time.Duration(rand.Int63n(int64(wiggle))) - (time.Duration(a.config.Period) * time.Second)
-	//
-	//				// Update header time to delayed one
-	//				header.Time = header.Time+uint64(delay.Seconds())
-	//
-	//				log.Trace("Waiting for recent signer block signing", "delay", common.PrettyDuration(delay))
-	//			}
-	//		}
-	//	}
+	if header.Difficulty.Cmp(turnDifficulty(a.config, true)) == 0 {
+		sealInTurnCounter.Inc(1)
+	} else {
+		sealNoTurnCounter.Inc(1)
+	}
+	return block.WithSeal(header), delay, nil
+}
 
-	go func() {
-		select {
-		case <-stop:
-			return
-		case <-time.After(delay):
-		}
+// sealDelay calculates how long to wait before releasing a sealed block. Recent
+// signers had their block time pushed out by the recents timeout in Prepare, and
+// both they and out-of-turn signers are delayed further by a random wiggle, unless
+// the chain config disables it.
+func (a *Atmos) sealDelay(snap *Snapshot, header *types.Header, recent bool) time.Duration {
+	delay := time.Unix(int64(header.Time), 0).Sub(a.clock())
+	return delay + a.sealWiggle(snap, header, recent)
+}
 
-		select {
-		case results <- block.WithSeal(header):
-		default:
-			log.Warn("Sealing result is not read by miner", "sealhash", SealHash(header))
-		}
-	}()
+// Added by Aerum
+// sealWiggle returns the random part of the seal delay, drawn from the engine's
+// random source so tests can reproduce it.
+func (a *Atmos) sealWiggle(snap *Snapshot, header *types.Header, recent bool) time.Duration {
+	if a.config.NoWiggle {
+		return 0
+	}
+	if !recent && header.Difficulty.Cmp(turnDifficulty(a.config, false)) != 0 {
+		return 0
+	}
+	// It's not our turn explicitly to sign, delay it a bit
+	wiggle := time.Duration(len(snap.Signers)/2+1) * a.config.WiggleTime
+	log.Trace("Out-of-turn signing requested", "wiggle", common.PrettyDuration(wiggle), "recent", recent)
 
-	return nil
+	a.randLock.Lock()
+	defer a.randLock.Unlock()
+
+	return time.Duration(rand.New(a.randSource).Int63n(int64(wiggle)))
 }
 
 // CalcDifficulty is the difficulty adjustment algorithm. It returns the difficulty
 // that a new block should have based on the previous blocks in the chain and the
 // current signer.
+//
+// If the snapshot needed to calculate the difficulty can't be assembled, the error
+// is logged and the out-of-turn difficulty returned as a safe default.
 func (a *Atmos) CalcDifficulty(chain consensus.ChainReader, time uint64, parent *types.Header) *big.Int {
+	difficulty, err := a.calcDifficulty(chain, parent)
+	if err != nil {
+		log.Error("Failed to calculate block difficulty", "parent", parent.Number, "hash", parent.Hash(), "err", err)
+		return turnDifficulty(a.config, false)
+	}
+	return difficulty
+}
+
+// calcDifficulty returns the difficulty that a new block on top of the given
+// parent should have, surfacing any error in assembling the snapshot for it.
+func (a *Atmos) calcDifficulty(chain consensus.ChainReader, parent *types.Header) (*big.Int, error) {
 	snap, err := a.snapshot(chain, parent.Number.Uint64(), parent.Hash(), nil)
 	if err != nil {
-		return nil
+		return nil, err
 	}
-	return CalcDifficulty(snap, a.signer)
+	return CalcDifficulty(snap, a.signer), nil
 }
 
 // CalcDifficulty is the difficulty adjustment algorithm. It returns the difficulty
 // that a new block should have based on the previous blocks in the chain and the
 // current signer.
 func CalcDifficulty(snap *Snapshot, signer common.Address) *big.Int {
-	if snap.inturn(snap.Number+1, signer) {
+	return turnDifficulty(snap.config, snap.inturn(snap.Number+1, signer))
+}
+
+// Added by Aerum
+// turnDifficulty returns the block difficulty for in-turn or out-of-turn
+// signatures, falling back to the defaults if the chain config doesn't set them.
+func turnDifficulty(config *params.AtmosConfig, inturn bool) *big.Int {
+	if inturn {
+		if config.InTurnDifficulty != 0 {
+			return new(big.Int).SetUint64(config.InTurnDifficulty)
+		}
 		return new(big.Int).Set(diffInTurn)
 	}
+	if config.OutOfTurnDifficulty != 0 {
+		return new(big.Int).SetUint64(config.OutOfTurnDifficulty)
+	}
 	return new(big.Int).Set(diffNoTurn)
 }
 
 // SealHash returns the hash of a block prior to it being sealed.
 func (a *Atmos) SealHash(header *types.Header) common.Hash {
-	return SealHash(header)
+	hash, err := cachedSealHash(header, header.Hash(), a.sealHashes)
+	if err != nil {
+		panic("can't encode: " + err.Error())
+	}
+	return hash
 }
 
-// Close implements consensus.Engine. It's a noop for atmos as there are no background threads.
+// Close implements consensus.Engine, aborting any in-flight governance lookups
+// and dropping all cached snapshots, signatures, seal hashes and composers. Any subsequent
+// snapshot request fails with errEngineClosed. It is safe to call multiple times.
 func (a *Atmos) Close() error {
+	a.cancel()
+
+	a.recents.Purge()
+	a.signatures.Purge()
+	a.sealHashes.Purge()
+	a.composers.Purge()
 	return nil
 }
 
@@ -727,11 +1587,47 @@ func (a *Atmos) APIs(chain consensus.ChainReader) []rpc.API {
 }
 
 // SealHash returns the hash of a block prior to it being sealed.
-func SealHash(header *types.Header) (hash common.Hash) {
+//
+// Note, the method requires the extra data to be at least 65 bytes, otherwise it
+// panics. Headers not yet validated should be hashed via sealHash instead.
+func SealHash(header *types.Header) common.Hash {
+	hash, err := sealHash(header)
+	if err != nil {
+		panic("can't encode: " + err.Error())
+	}
+	return hash
+}
+
+// sealHash returns the hash of a block prior to it being sealed, or an error if
+// the header's extra data is too short to contain a signature.
+func sealHash(header *types.Header) (hash common.Hash, err error) {
 	hasher := sha3.NewLegacyKeccak256()
-	encodeSigHeader(hasher, header)
+	if err := encodeSigHeader(hasher, header); err != nil {
+		return common.Hash{}, err
+	}
 	hasher.Sum(hash[:0])
-	return hash
+	return hash, nil
+}
+
+// Added by Aerum
+// cachedSealHash returns the seal hash of a header, consulting and populating the
+// optional cache. The cache is keyed by the full header hash, which covers the
+// signature too: differently sealed copies of a header never share an entry, so
+// a cached digest is always the one the header itself would produce.
+func cachedSealHash(header *types.Header, hash common.Hash, cache *lru.ARCCache) (common.Hash, error) {
+	if cache != nil {
+		if sighash, known := cache.Get(hash); known {
+			return sighash.(common.Hash), nil
+		}
+	}
+	sighash, err := sealHash(header)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	if cache != nil {
+		cache.Add(hash, sighash)
+	}
+	return sighash, nil
 }
 
 // AtmosRLP returns the rlp bytes which needs to be signed for the proof-of-authority
@@ -743,12 +1639,40 @@ func SealHash(header *types.Header) (hash common.Hash) {
 // or not), which could be abused to produce different hashes for the same header.
 func AtmosRLP(header *types.Header) []byte {
 	b := new(bytes.Buffer)
-	encodeSigHeader(b, header)
+	if err := encodeSigHeader(b, header); err != nil {
+		panic("can't encode: " + err.Error())
+	}
 	return b.Bytes()
 }
 
-func encodeSigHeader(w io.Writer, header *types.Header) {
-	err := rlp.Encode(w, []interface{}{
+// Added by Aerum
+// SealBytes returns the bytes to sign for sealing the header, the same ones that
+// AtmosRLP produces. Unlike it, an error is returned instead of panicking if the
+// extra data is too short to contain a signature, so it's safe to use on headers
+// coming from external signers.
+func SealBytes(header *types.Header) ([]byte, error) {
+	b := new(bytes.Buffer)
+	if err := encodeSigHeader(b, header); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// Added by Aerum
+// SealDigest returns the hash of a block prior to it being sealed, the same one
+// that SealHash produces. Unlike it, an error is returned instead of panicking if
+// the extra data is too short to contain a signature.
+func SealDigest(header *types.Header) (common.Hash, error) {
+	return sealHash(header)
+}
+
+// encodeSigHeader writes the RLP encoding of the header without its seal into w,
+// failing with errMissingSignature if the extra data can't contain a seal.
+func encodeSigHeader(w io.Writer, header *types.Header) error {
+	if len(header.Extra) < extraSeal {
+		return errMissingSignature
+	}
+	return rlp.Encode(w, []interface{}{
 		header.ParentHash,
 		header.UncleHash,
 		header.Coinbase,
@@ -761,47 +1685,311 @@ func encodeSigHeader(w io.Writer, header *types.Header) {
 		header.GasLimit,
 		header.GasUsed,
 		header.Time,
-		header.Extra[:len(header.Extra)-65], // Yes, this will panic if extra is too short
+		header.Extra[:len(header.Extra)-extraSeal],
 		header.MixDigest,
 		header.Nonce,
 	})
-	if err != nil {
-		panic("can't encode: " + err.Error())
+}
+
+// Added by Aerum
+// MakeExtraData builds the extra-data of an Atmos genesis or checkpoint header:
+// a zeroed vanity prefix, the signers sorted bytewise without duplicates and a
+// zeroed seal suffix. The passed signer list is not modified.
+func MakeExtraData(signers []common.Address) []byte {
+	sorted := sortAndDedupSigners(signers)
+
+	extra := make([]byte, extraVanity+len(sorted)*common.AddressLength+extraSeal)
+	for i, signer := range sorted {
+		copy(extra[extraVanity+i*common.AddressLength:], signer[:])
 	}
+	return extra
+}
+
+// Added by Aerum
+// composersKey identifies a governance lookup. The composers returned by the
+// contract are fully determined by the epoch and the check timestamp.
+type composersKey struct {
+	epoch     uint64
+	timestamp int64
 }
 
 // Added by Aerum
-func getComposers(chain consensus.ChainReader, config *params.AtmosConfig, number uint64, parents []*types.Header) ([]common.Address, error) {
-	ethereumApiEndpoint := getEthereumApiEndpoint(config)
-	client, err := ethclient.Dial(ethereumApiEndpoint)
+// epochSigners retrieves the signers for the given epoch block, only reaching
+// out to the governance contract if they aren't cached in memory or on disk yet.
+// Chains running with static signers never reach out to governance.
+func (a *Atmos) epochSigners(ctx context.Context, chain consensus.ChainReader, number uint64, parents []*types.Header) ([]common.Address, error) {
+	if a.config.StaticSigners {
+		return nil, errStaticSigners
+	}
+	timestamp, err := getComposersCheckTimestamp(a.config, chain, number, parents)
 	if err != nil {
 		return nil, err
 	}
 
-	governanceAddress := getGovernanceAddress(config)
-	caller, err := guvnor.NewAtmosCaller(governanceAddress, client)
+	key := composersKey{epoch: number / a.config.Epoch, timestamp: timestamp.Int64()}
+	if signers, ok := a.composers.Get(key); ok {
+		return signers.([]common.Address), nil
+	}
+	if signers, err := loadComposers(a.db, key); err == nil && len(signers) > 0 {
+		log.Trace("Loaded governance signers from disk", "number", number, "time", timestamp)
+		a.composers.Add(key, signers)
+		return signers, nil
+	}
+	signers, err := a.fetchEpochSigners(ctx, number, timestamp)
 	if err != nil {
 		return nil, err
 	}
+	if len(signers) > 0 {
+		a.cacheEpochSigners(key, signers)
+	}
+	return signers, nil
+}
+
+// Added by Aerum
+// fetchEpochSigners queries the composer source for the signers of the given
+// epoch block, bounded by the governance call timeout and the engine lifetime.
+func (a *Atmos) fetchEpochSigners(ctx context.Context, number uint64, timestamp *big.Int) ([]common.Address, error) {
+	ctx, cancel := context.WithTimeout(ctx, a.config.GovernanceCallTimeout)
+	defer cancel()
+
+	// Abort the lookup if the engine is closed meanwhile
+	go func() {
+		select {
+		case <-a.ctx.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	a.lock.RLock()
+	source := a.source
+	a.lock.RUnlock()
+
+	start := time.Now()
+	signers, err := source.Composers(ctx, number, timestamp)
+	governanceComposersTimer.UpdateSince(start)
+	return signers, err
+}
+
+// Added by Aerum
+// cacheEpochSigners stores the signers loaded from governance for a lookup, both
+// in memory and on disk, replacing any previous ones.
+func (a *Atmos) cacheEpochSigners(key composersKey, signers []common.Address) {
+	if err := storeComposers(a.db, key, signers); err != nil {
+		log.Warn("Failed to store governance signers", "epoch", key.epoch, "time", key.timestamp, "err", err)
+	}
+	a.composers.Add(key, signers)
+	a.trackSigners(key.epoch, signers)
+}
+
+// Added by Aerum
+// trackSigners records the signer set loaded from governance for an epoch, if it
+// is the most recent one seen, persisting it for the grace period accounting to
+// survive restarts.
+func (a *Atmos) trackSigners(epoch uint64, signers []common.Address) {
+	if len(signers) == 0 {
+		return
+	}
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if a.lastSigners != nil && epoch < a.lastSignersEpoch {
+		return
+	}
+	a.lastSigners, a.lastSignersEpoch = signers, epoch
+	if a.db != nil {
+		if err := storeLastSigners(a.db, epoch, signers); err != nil {
+			log.Warn("Failed to store last governance signers", "epoch", epoch, "err", err)
+		}
+	}
+}
 
-	composersCheckTimestamp := big.NewInt(0)
+// Added by Aerum
+// graceSigners returns the signers to carry over into the given epoch block if
+// governance failed to serve its committee, or nil if the failure must not be
+// tolerated since the epoch is beyond the configured grace period after the last
+// committee loaded from governance. The carried over signers are the committee of
+// the epoch the block closes, as recorded by the chain itself, so all nodes
+// tolerating the failure fall back to the same set regardless of their history.
+// The fallback is persisted as the epoch's governance signers, keeping the epoch
+// stable across cache evictions and restarts.
+func (a *Atmos) graceSigners(ctx context.Context, chain consensus.ChainReader, number uint64, hash common.Hash, parents []*types.Header) []common.Address {
+	a.lock.RLock()
+	loaded, last := a.lastSigners != nil, a.lastSignersEpoch
+	a.lock.RUnlock()
+
+	epoch := number / a.config.Epoch
+	if !loaded || epoch <= last || epoch-last > a.config.GovernanceGracePeriodEpochs {
+		return nil
+	}
+	timestamp, err := getComposersCheckTimestamp(a.config, chain, number, parents)
+	if err != nil {
+		return nil
+	}
+	// Resolve the committee of the previous epoch from the snapshot preceding the block
+	var header *types.Header
+	if len(parents) > 0 {
+		header, parents = parents[len(parents)-1], parents[:len(parents)-1]
+	} else {
+		header = chain.GetHeader(hash, number)
+	}
+	if header == nil || header.Hash() != hash {
+		return nil
+	}
+	snap, err := a.snapshotCtx(ctx, chain, number-1, header.ParentHash, parents)
+	if err != nil {
+		log.Warn("Failed to retrieve the previous signers", "number", number, "err", err)
+		return nil
+	}
+	log.Warn("Governance unavailable, continuing with the previous signers", "number", number, "loaded", last*a.config.Epoch, "epochs", epoch-last, "grace", a.config.GovernanceGracePeriodEpochs)
+
+	// Persist the carried over committee as the epoch's governance signers, so
+	// the checkpoint isn't rebuilt differently once governance is reachable again
+	signers := snap.signers()
+	key := composersKey{epoch: epoch, timestamp: timestamp.Int64()}
+	if err := storeComposers(a.db, key, signers); err != nil {
+		log.Warn("Failed to store grace signers", "number", number, "time", timestamp, "err", err)
+	}
+	a.composers.Add(key, signers)
+	return signers
+}
+
+// Added by Aerum
+// CheckGovernance verifies that the governance contract can be queried through
+// the configured Ethereum endpoints and that it has composers registered, so
+// misconfigured nodes fail at startup instead of at the next epoch boundary.
+// Chains running with static signers never reach out to governance, so they
+// aren't checked.
+func (a *Atmos) CheckGovernance(ctx context.Context) error {
+	if a.config.StaticSigners {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, a.config.GovernanceCallTimeout)
+	defer cancel()
+
+	timestamp := a.clock().Unix() - *a.config.GovernanceLookbackSeconds
+	if timestamp < 0 {
+		timestamp = 0
+	}
+	addresses, _, err := queryComposers(ctx, a.config, 0, big.NewInt(timestamp))
+	if err != nil {
+		return fmt.Errorf("governance contract %x unreachable: %v", getGovernanceAddress(a.config), err)
+	}
+	if len(addresses) == 0 {
+		return errNoComposers
+	}
+	return nil
+}
+
+// Added by Aerum
+// refreshEpochSigners reloads the signers of the epoch containing the given block
+// from the composer source, replacing the cached ones. The cached signers are
+// only replaced if the source served a non-empty set, so a refresh issued while
+// governance is unreachable keeps the epoch served.
+func (a *Atmos) refreshEpochSigners(chain consensus.ChainReader, number uint64) ([]common.Address, error) {
+	number -= number % a.config.Epoch
+
+	timestamp, err := getComposersCheckTimestamp(a.config, chain, number, nil)
+	if err != nil {
+		return nil, err
+	}
+	signers, err := a.fetchEpochSigners(context.Background(), number, timestamp)
+	if err != nil {
+		return nil, err
+	}
+	if len(signers) == 0 {
+		return nil, errNoComposers
+	}
+	a.cacheEpochSigners(composersKey{epoch: number / a.config.Epoch, timestamp: timestamp.Int64()}, signers)
+	return signers, nil
+}
+
+// Added by Aerum
+// RepairSnapshot discards the stored snapshot of an epoch's checkpoint block and
+// rebuilds it the same way it was originally assembled, from the trusted
+// checkpoints or governance. The signers embedded into the checkpoint, being the
+// committee of the epoch it closes, are only used to cross-check the snapshot
+// preceding it. The rebuilt snapshot is stored in place of the discarded one and
+// the in-memory snapshots, possibly derived from it, are dropped.
+func (a *Atmos) RepairSnapshot(chain consensus.ChainReader, epoch uint64) error {
+	number := epoch * a.config.Epoch
+
+	header := chain.GetHeaderByNumber(number)
+	if header == nil {
+		return errUnknownBlock
+	}
+	hash := header.Hash()
+
+	a.recents.Purge()
+
+	// Refuse to rebuild on top of a local chain disagreeing with the checkpoint
 	if number > 0 {
-		// Get previous block to get time from it
-		prevHeader := getHeader(chain, parents, number-1)
+		parent, err := a.snapshot(chain, number-1, header.ParentHash, nil)
+		if err != nil {
+			return err
+		}
+		if err := a.checkCheckpointSigners(parent, header); err != nil {
+			return err
+		}
+	}
+	if err := deleteSnapshot(a.db, hash); err != nil {
+		return err
+	}
+	snap, err := a.snapshot(chain, number, hash, nil)
+	if err != nil {
+		return err
+	}
+	if err := snap.store(a.db); err != nil {
+		return err
+	}
+	log.Info("Repaired checkpoint snapshot", "epoch", epoch, "number", number, "hash", hash, "signers", len(snap.Signers))
+	return nil
+}
 
-		// Take composers for 20 minutes before now to make sure Ethereum syncs and there is no forks
-		var ethereumSyncTimeoutInSeconds int64 = 20 * 60
-		composersCheckTimestamp = big.NewInt(int64(prevHeader.Time) - ethereumSyncTimeoutInSeconds)
+// Added by Aerum
+// getComposersCheckTimestamp returns the timestamp at which the governance
+// contract should be queried for the composers of the given epoch block.
+func getComposersCheckTimestamp(config *params.AtmosConfig, chain consensus.ChainReader, number uint64, parents []*types.Header) (*big.Int, error) {
+	if number == 0 {
+		return big.NewInt(0), nil
+	}
+	// Get previous block to get time from it
+	prevHeader := getHeader(chain, parents, number-1)
+	if prevHeader == nil {
+		return nil, consensus.ErrUnknownAncestor
 	}
+	// Take composers from a while before now to make sure Ethereum syncs and there is no forks
+	timestamp := int64(prevHeader.Time) - *config.GovernanceLookbackSeconds
+	if timestamp < 0 {
+		timestamp = 0
+	}
+	return big.NewInt(timestamp), nil
+}
 
+// Added by Aerum
+// getComposers loads the composers registered in the governance contract for the
+// given epoch block and selects the signers out of them. Failed lookups are retried
+// with an exponential backoff. The context bounds both dialing the endpoints and
+// the contract calls themselves, as well as any waits in between retries.
+func getComposers(ctx context.Context, config *params.AtmosConfig, number uint64, composersCheckTimestamp *big.Int) ([]common.Address, error) {
 	log.Info("Loading new headers", "number", number, "time", composersCheckTimestamp)
-	addresses, stakes, err := caller.GetComposers(&bind.CallOpts{}, big.NewInt(int64(number)), composersCheckTimestamp)
-	if err != nil {
+
+	addresses, stakes, err := queryComposers(ctx, config, number, composersCheckTimestamp)
+	for retry, delay := 0, governanceRetryDelay; len(addresses) == 0 && retry < config.GovernanceRetries; retry, delay = retry+1, delay*2 {
+		log.Warn("Retrying governance lookup", "number", number, "retry", retry+1, "delay", delay, "err", err)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+		addresses, stakes, err = queryComposers(ctx, config, number, composersCheckTimestamp)
+	}
+	if len(addresses) == 0 {
 		return nil, err
 	}
 
 	// We select only limited number of signers and shift them on every epoch
-	selectedAddresses := signersProbabilisticSelection(addresses, stakes, number)
+	selectedAddresses := signersProbabilisticSelection(config, addresses, stakes, number)
 
 	// Log selected signers
 	hexAddresses := make([]string, 0)
@@ -814,21 +2002,138 @@ func getComposers(chain consensus.ChainReader, config *params.AtmosConfig, numbe
 }
 
 // Added by Aerum
-func signersProbabilisticSelection(addresses []common.Address, stakes []*big.Int, number uint64) []common.Address {
-	actualNumberOfSigners := int(math.Min(float64(len(addresses)), numberOfSigners))
-	log.Info("Selecting new signers", "actual number of signers", actualNumberOfSigners)
+// queryComposers retrieves the composers and their stakes from the governance
+// contract. The configured Ethereum endpoints are tried in order until one returns
+// a non-empty composer set.
+func queryComposers(ctx context.Context, config *params.AtmosConfig, number uint64, composersCheckTimestamp *big.Int) ([]common.Address, []*big.Int, error) {
+	governanceAddress := getGovernanceAddress(config)
+
+	var lastErr error
+	for _, endpoint := range getEthereumApiEndpoints(config) {
+		addresses, stakes, err := callComposers(ctx, endpoint, governanceAddress, config.GovernancePinnedBlock, config.GovernanceConfirmations, number, composersCheckTimestamp)
+		if err != nil {
+			log.Warn("Failed to load composers from governance", "endpoint", endpoint, "err", err)
+			lastErr = err
+			continue
+		}
+		if len(addresses) == 0 {
+			log.Warn("Governance returned no composers", "endpoint", endpoint)
+			continue
+		}
+		log.Info("Loaded composers from governance", "endpoint", endpoint, "composers", len(addresses))
+		return addresses, stakes, nil
+	}
+	return nil, nil, lastErr
+}
+
+// Added by Aerum
+// callComposers queries the governance contract through a single Ethereum endpoint.
+// If a pinned block is given, the contract state and timestamp of that Ethereum
+// block are used instead of the latest state, making the lookup reproducible.
+// Otherwise, if a confirmation depth is given, the lookup is refused unless the
+// lookup timestamp is buried under at least that many Ethereum blocks, so the
+// governance state read can't be reorged anymore.
+func callComposers(ctx context.Context, endpoint string, governanceAddress common.Address, pinned *big.Int, confirmations uint64, number uint64, composersCheckTimestamp *big.Int) ([]common.Address, []*big.Int, error) {
+	client, err := dialEthereum(ctx, endpoint)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to dial ethereum endpoint: %v", err)
+	}
+	defer client.Close()
+
+	// Make sure the node synced past the lookup time, otherwise its reads are stale
+	head, err := client.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to retrieve ethereum head: %v", err)
+	}
+	opts := &bind.CallOpts{Context: ctx}
+	switch {
+	case pinned != nil:
+		if head.Number.Cmp(pinned) < 0 {
+			log.Warn("Governance node behind pinned block", "endpoint", endpoint, "head", head.Number, "pinned", pinned)
+			return nil, nil, errGovernanceNodeBehind
+		}
+		block, err := client.HeaderByNumber(ctx, pinned)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to retrieve pinned ethereum block: %v", err)
+		}
+		opts.BlockNumber = pinned
+		composersCheckTimestamp = new(big.Int).SetUint64(block.Time)
+
+	case confirmations > 0:
+		depth := new(big.Int).SetUint64(confirmations)
+		if head.Number.Cmp(depth) < 0 {
+			log.Warn("Governance node behind confirmation depth", "endpoint", endpoint, "head", head.Number, "confirmations", confirmations)
+			return nil, nil, errGovernanceNodeBehind
+		}
+		block, err := client.HeaderByNumber(ctx, new(big.Int).Sub(head.Number, depth))
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to retrieve confirmed ethereum block: %v", err)
+		}
+		if new(big.Int).SetUint64(block.Time).Cmp(composersCheckTimestamp) < 0 {
+			log.Warn("Governance lookup not confirmed yet", "endpoint", endpoint, "confirmed", block.Number, "time", block.Time, "lookup", composersCheckTimestamp, "confirmations", confirmations)
+			return nil, nil, errGovernanceNodeBehind
+		}
 
+	default:
+		if new(big.Int).SetUint64(head.Time).Cmp(composersCheckTimestamp) < 0 {
+			log.Warn("Governance node behind lookup time", "endpoint", endpoint, "head", head.Number, "time", head.Time, "lookup", composersCheckTimestamp)
+			return nil, nil, errGovernanceNodeBehind
+		}
+	}
+	caller, err := guvnor.NewAtmosCaller(governanceAddress, client)
+	if err != nil {
+		return nil, nil, err
+	}
+	addresses, stakes, err := caller.GetComposers(opts, big.NewInt(int64(number)), composersCheckTimestamp)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to query governance composers: %v", err)
+	}
+	// The stakes must line up with the composers, otherwise the committee would be
+	// selected with misattributed weights
+	if len(addresses) > 0 && len(stakes) != len(addresses) {
+		log.Warn("Governance returned mismatching stakes", "endpoint", endpoint, "composers", len(addresses), "stakes", len(stakes))
+		return nil, nil, errComposerStakesMismatch
+	}
+	return addresses, stakes, nil
+}
+
+// Added by Aerum
+// stakeWeights rounds the composer stakes down to whole tokens, returning the
+// weights the signers are selected by along with their sum.
+func stakeWeights(stakes []*big.Int) ([]int64, int64) {
 	var totalWeight int64 = 0
-	weights := make([]int64, 0)
+	weights := make([]int64, 0, len(stakes))
 	decimalsDivider := new(big.Int).Exp(big.NewInt(10), big.NewInt(18), nil)
-	for index := 0; index < len(addresses); index++ {
+	for index := 0; index < len(stakes); index++ {
 		roundedStake := new(big.Int).Div(stakes[index], decimalsDivider).Int64()
 		weights = append(weights, roundedStake)
 		totalWeight += roundedStake
 	}
+	return weights, totalWeight
+}
+
+// Added by Aerum
+// selectionSeed returns the seed of the random signer selection for an epoch
+// block, derived from the total stake weight of the composers.
+func selectionSeed(totalWeight int64, number uint64) int64 {
+	return totalWeight + int64(number)
+}
+
+// Added by Aerum
+func signersProbabilisticSelection(config *params.AtmosConfig, addresses []common.Address, stakes []*big.Int, number uint64) []common.Address {
+	if len(addresses) == 0 {
+		return []common.Address{}
+	}
+	actualNumberOfSigners := int(math.Min(float64(len(addresses)), float64(config.SignersPerEpoch)))
+	log.Info("Selecting new signers", "actual number of signers", actualNumberOfSigners)
+
+	weights, totalWeight := stakeWeights(stakes)
 	log.Info("Selecting new signers", "total stake", totalWeight)
 
-	rand := rand.New(rand.NewSource(totalWeight + int64(number)))
+	// Work on a copy so removing picked signers doesn't clobber the caller's slice
+	addresses = append([]common.Address(nil), addresses...)
+
+	rand := rand.New(rand.NewSource(selectionSeed(totalWeight, number)))
 	selectedAddresses := make([]common.Address, 0)
 	for index := 0; index < actualNumberOfSigners; index++ {
 		selectedAddress, selectedIndex, _ := selectRandomWeightedSigner(rand, addresses, weights, totalWeight)
@@ -839,12 +2144,20 @@ func signersProbabilisticSelection(addresses []common.Address, stakes []*big.Int
 		addresses = removeAddressByIndex(addresses, selectedIndex)
 		weights = removeInt64ByIndex(weights, selectedIndex)
 	}
-
-	return selectedAddresses
+	// Order the committee the same way checkpoint headers embed it, dropping any
+	// composers listed multiple times by governance
+	return sortAndDedupSigners(selectedAddresses)
 }
 
 // Added by Aerum
 func selectRandomWeightedSigner(rand *rand.Rand, addresses []common.Address, weights []int64, totalWeight int64) (common.Address, int, error) {
+	if len(addresses) == 0 {
+		return common.Address{}, 0, errors.New("no address selected")
+	}
+	// Composers without any significant stake can't be weighted, pick them in order
+	if totalWeight <= 0 {
+		return addresses[0], 0, nil
+	}
 	randomWeight := rand.Int63n(totalWeight)
 	for index, address := range addresses {
 		randomWeight -= weights[index]
@@ -881,14 +2194,79 @@ func getHeader(chain consensus.ChainReader, parents []*types.Header, number uint
 }
 
 // Added by Aerum
-func accumulateRewards(a *Atmos, state *state.StateDB, header *types.Header) {
-	// Try to get block signer from the block header. Otherwise use atmos singer(on mining)
-	signer, err := ecrecover(header, a.signatures)
-	if err != nil {
-		signer = a.signer
+// recentHeaders gathers the header with the given number and hash along with its
+// ancestors, at most limit of them, in ascending order. Explicit parents take
+// precedence over the database. The walk stops early at the genesis block, which
+// isn't signed, or at the first header not available.
+func recentHeaders(chain consensus.ChainReader, parents []*types.Header, number uint64, hash common.Hash, limit uint64) []*types.Header {
+	var headers []*types.Header
+	for uint64(len(headers)) < limit && number > 0 {
+		var header *types.Header
+		if len(parents) > 0 && parents[len(parents)-1].Hash() == hash {
+			header, parents = parents[len(parents)-1], parents[:len(parents)-1]
+		} else if chain != nil {
+			header = chain.GetHeader(hash, number)
+		}
+		if header == nil {
+			break
+		}
+		headers = append(headers, header)
+		number, hash = number-1, header.ParentHash
 	}
-	// Just add block rewards to signer
-	state.AddBalance(signer, BlockReward)
+	for i := 0; i < len(headers)/2; i++ {
+		headers[i], headers[len(headers)-1-i] = headers[len(headers)-1-i], headers[i]
+	}
+	return headers
+}
+
+// Added by Aerum
+// accumulateRewards credits the signer of the given block with the block reward.
+// Checkpoint blocks are skipped if the chain config opts out of rewarding them,
+// as are signers not holding the minimum balance required by the chain config.
+// If a treasury cut is configured, the floor of that share goes to the treasury
+// and the signer receives the remainder.
+func accumulateRewards(a *Atmos, state *state.StateDB, header *types.Header, signer common.Address) {
+	if reward := a.config.RewardEpochBlocks; reward != nil && !*reward && header.Number.Uint64()%a.config.Epoch == 0 {
+		return
+	}
+	if min := a.config.MinSignerBalance; min != nil {
+		if balance := state.GetBalance(signer); balance.Cmp(min) < 0 {
+			log.Debug("Signer balance below minimum, skipping reward", "number", header.Number, "signer", signer, "balance", balance, "min", min)
+			return
+		}
+	}
+	// Just add block rewards to signer, without touching it on gas-only chains
+	reward := a.blockReward(header.Number)
+	if a.config.TreasuryRewardBps > 0 {
+		cut := new(big.Int).Mul(reward, new(big.Int).SetUint64(a.config.TreasuryRewardBps))
+		cut.Div(cut, big.NewInt(maxTreasuryBps))
+		if cut.Sign() > 0 {
+			state.AddBalance(a.config.TreasuryAddress, cut)
+		}
+		reward = new(big.Int).Sub(reward, cut)
+	}
+	if reward.Sign() > 0 {
+		state.AddBalance(signer, reward)
+	}
+}
+
+// Added by Aerum
+// blockReward returns the reward credited to the signer of the given block,
+// falling back to the network default if the chain config doesn't set one. If a
+// halving interval is configured, the reward is halved every interval blocks.
+func (a *Atmos) blockReward(number *big.Int) *big.Int {
+	reward := params.NewAtmosBlockRewards()
+	if a.config.BlockReward != nil {
+		reward = a.config.BlockReward
+	}
+	if a.config.RewardHalvingInterval == 0 {
+		return reward
+	}
+	halvings := number.Uint64() / a.config.RewardHalvingInterval
+	if halvings >= uint64(reward.BitLen()) {
+		return new(big.Int)
+	}
+	return new(big.Int).Rsh(reward, uint(halvings))
 }
 
 // Added by Aerum
@@ -909,19 +2287,30 @@ func getParentHeader(chain consensus.ChainReader, header *types.Header, parents
 }
 
 // Added by Aerum
-func getEthereumApiEndpoint(config *params.AtmosConfig) string {
+// getEthereumApiEndpoints returns the Ethereum endpoints to query governance through,
+// in order of preference. The legacy single endpoint, if set, is tried first.
+func getEthereumApiEndpoints(config *params.AtmosConfig) []string {
+	var endpoints []string
 	if config.EthereumApiEndpoint != "" {
-		return config.EthereumApiEndpoint
+		endpoints = append(endpoints, config.EthereumApiEndpoint)
+	}
+	for _, endpoint := range config.EthereumApiEndpoints {
+		if endpoint != "" && endpoint != config.EthereumApiEndpoint {
+			endpoints = append(endpoints, endpoint)
+		}
+	}
+	if len(endpoints) > 0 {
+		return endpoints
 	}
 	if config.EnableTestNet {
-		return params.NewAtmosTestEthereumRPCProvider()
+		return []string{params.NewAtmosTestEthereumRPCProvider()}
 	}
-	return params.NewAtmosEthereumRPCProvider()
+	return []string{params.NewAtmosEthereumRPCProvider()}
 }
 
 // Added by Aerum
 func getGovernanceAddress(config *params.AtmosConfig) common.Address {
-	if config.EthereumApiEndpoint != "" {
+	if config.EthereumApiEndpoint != "" || len(config.EthereumApiEndpoints) > 0 {
 		return config.GovernanceAddress
 	}
 	if config.EnableTestNet {
@@ -0,0 +1,3064 @@
+// Copyright 2017 The go-aerum Authors
+// This file is part of the go-aerum library.
+//
+// The go-aerum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-aerum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-aerum library. If not, see <http://www.gnu.org/licenses/>.
+
+package atmos
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/AERUMTechnology/go-aerum/accounts"
+	"github.com/AERUMTechnology/go-aerum/accounts/abi"
+	"github.com/AERUMTechnology/go-aerum/common"
+	"github.com/AERUMTechnology/go-aerum/common/hexutil"
+	"github.com/AERUMTechnology/go-aerum/consensus"
+	guvnor "github.com/AERUMTechnology/go-aerum/contracts/atmosGovernance"
+	"github.com/AERUMTechnology/go-aerum/core"
+	"github.com/AERUMTechnology/go-aerum/core/rawdb"
+	"github.com/AERUMTechnology/go-aerum/core/state"
+	"github.com/AERUMTechnology/go-aerum/core/types"
+	"github.com/AERUMTechnology/go-aerum/core/vm"
+	"github.com/AERUMTechnology/go-aerum/crypto"
+	"github.com/AERUMTechnology/go-aerum/ethclient"
+	"github.com/AERUMTechnology/go-aerum/ethdb"
+	"github.com/AERUMTechnology/go-aerum/log"
+	"github.com/AERUMTechnology/go-aerum/metrics"
+	"github.com/AERUMTechnology/go-aerum/params"
+	lru "github.com/hashicorp/golang-lru"
+)
+
+// testerAccountPool is a pool to maintain currently active tester accounts,
+// mapped from textual names used in the tests below to actual Ethereum private
+// keys capable of signing blocks.
+type testerAccountPool struct {
+	accounts map[string]*ecdsa.PrivateKey
+}
+
+func newTesterAccountPool() *testerAccountPool {
+	return &testerAccountPool{
+		accounts: make(map[string]*ecdsa.PrivateKey),
+	}
+}
+
+// address retrieves the Ethereum address of a tester account by label, creating
+// a new account if no previous one exists yet.
+func (ap *testerAccountPool) address(account string) common.Address {
+	if ap.accounts[account] == nil {
+		ap.accounts[account], _ = crypto.GenerateKey()
+	}
+	return crypto.PubkeyToAddress(ap.accounts[account].PublicKey)
+}
+
+// sign calculates an Atmos digital signature for the given block and embeds it
+// back into the header.
+func (ap *testerAccountPool) sign(header *types.Header, signer string) {
+	if ap.accounts[signer] == nil {
+		ap.accounts[signer], _ = crypto.GenerateKey()
+	}
+	sig, _ := crypto.Sign(SealHash(header).Bytes(), ap.accounts[signer])
+	copy(header.Extra[len(header.Extra)-extraSeal:], sig)
+}
+
+// signFn returns a signer callback sealing with the key of a tester account.
+func (ap *testerAccountPool) signFn(signer string) SignerFn {
+	ap.address(signer)
+	return func(account accounts.Account, mimeType string, data []byte) ([]byte, error) {
+		return crypto.Sign(crypto.Keccak256(data), ap.accounts[signer])
+	}
+}
+
+// sorted returns the labels of the given tester accounts, ordered by address.
+func (ap *testerAccountPool) sorted(signers []string) []string {
+	labels := append([]string(nil), signers...)
+	sort.Slice(labels, func(i, j int) bool {
+		a, b := ap.address(labels[i]), ap.address(labels[j])
+		return bytes.Compare(a[:], b[:]) < 0
+	})
+	return labels
+}
+
+// testerChain is a live Atmos blockchain seeded with a set of genesis signers.
+type testerChain struct {
+	*core.BlockChain
+
+	engine   *Atmos
+	accounts *testerAccountPool
+	signers  []string // Genesis signer labels, sorted by address
+	config   *params.ChainConfig
+	genesis  *types.Block
+	db       ethdb.Database
+}
+
+// unreachableEndpoint returns the URL of an Ethereum endpoint refusing all connections.
+func unreachableEndpoint() string {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+	return srv.URL
+}
+
+// newTesterChain creates an Atmos chain with the given genesis signers, and
+// imports the requested number of blocks, each sealed by the in-turn signer.
+func newTesterChain(t testing.TB, atmosConfig *params.AtmosConfig, signers []string, blocks int) *testerChain {
+	return newTesterChainWithAccounts(t, atmosConfig, newTesterAccountPool(), signers, blocks)
+}
+
+// newTesterChainWithAccounts creates an Atmos chain similarly to newTesterChain,
+// but uses a pre-populated account pool to sign with.
+func newTesterChainWithAccounts(t testing.TB, atmosConfig *params.AtmosConfig, accounts *testerAccountPool, signers []string, blocks int) *testerChain {
+	signers = accounts.sorted(signers)
+
+	// Create the genesis block with the initial set of signers
+	genspec := &core.Genesis{
+		ExtraData: make([]byte, extraVanity+common.AddressLength*len(signers)+extraSeal),
+	}
+	for i, signer := range signers {
+		copy(genspec.ExtraData[extraVanity+i*common.AddressLength:], accounts.address(signer).Bytes())
+	}
+	db := rawdb.NewMemoryDatabase()
+	genesis := genspec.MustCommit(db)
+
+	// Governance must never be reached out to while the chain is being tested
+	if atmosConfig.EthereumApiEndpoint == "" && len(atmosConfig.EthereumApiEndpoints) == 0 {
+		conf := *atmosConfig
+		conf.EthereumApiEndpoint = unreachableEndpoint()
+		conf.GovernanceRetries = -1
+		atmosConfig = &conf
+	}
+	config := *params.TestChainConfig
+	config.Ethash = nil
+	config.Atmos = atmosConfig
+
+	engine := New(config.Atmos, db)
+	chain, err := core.NewBlockChain(db, nil, &config, engine, vm.Config{}, nil)
+	if err != nil {
+		t.Fatalf("failed to create test chain: %v", err)
+	}
+	tester := &testerChain{
+		BlockChain: chain,
+		engine:     engine,
+		accounts:   accounts,
+		signers:    signers,
+		config:     &config,
+		genesis:    genesis,
+		db:         db,
+	}
+	tester.extend(t, blocks)
+	return tester
+}
+
+// extend imports the requested number of new blocks on top of the current head,
+// each sealed by the in-turn signer.
+func (tc *testerChain) extend(t testing.TB, n int) []*types.Block {
+	blocks := tc.generate(n, tc.inturn, nil)
+	if k, err := tc.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to import block %d: %v", k, err)
+	}
+	return blocks
+}
+
+// generate creates, but does not import, the requested number of blocks on top
+// of the current head. Each block is sealed by the signer picked by the callback,
+// after the optional tweak callback had the chance to modify the header.
+func (tc *testerChain) generate(n int, signer func(number uint64) string, tweak func(header *types.Header)) []*types.Block {
+	if n == 0 {
+		return nil
+	}
+	parent := tc.CurrentBlock()
+	blocks, _ := core.GenerateChain(tc.config, parent, tc.engine, tc.db, n, func(i int, gen *core.BlockGen) {
+		// Rewards are credited to the local signer during block generation
+		tc.engine.Authorize(tc.accounts.address(signer(gen.Number().Uint64())), nil)
+	})
+	for i, block := range blocks {
+		header := block.Header()
+		if i > 0 {
+			header.ParentHash = blocks[i-1].Hash()
+		}
+		number := header.Number.Uint64()
+
+		header.Extra = make([]byte, extraVanity+extraSeal)
+		if number%tc.engine.config.Epoch == 0 {
+			header.Extra = make([]byte, extraVanity+len(tc.signers)*common.AddressLength+extraSeal)
+			for j, signer := range tc.signers {
+				copy(header.Extra[extraVanity+j*common.AddressLength:], tc.accounts.address(signer).Bytes())
+			}
+		}
+		header.Difficulty = turnDifficulty(tc.engine.config, signer(number) == tc.inturn(number))
+		if tweak != nil {
+			tweak(header)
+		}
+		tc.accounts.sign(header, signer(number))
+		blocks[i] = block.WithSeal(header)
+	}
+	return blocks
+}
+
+// inturn returns the label of the signer in-turn for the given block.
+func (tc *testerChain) inturn(number uint64) string {
+	return tc.signers[number%uint64(len(tc.signers))]
+}
+
+// rotate switches the committee sealing, and embedded into the checkpoints of,
+// subsequently generated blocks to the given signers.
+func (tc *testerChain) rotate(signers []string) {
+	tc.signers = tc.accounts.sorted(signers)
+}
+
+// addresses returns the sorted addresses of the genesis signers.
+func (tc *testerChain) addresses() []common.Address {
+	addresses := make([]common.Address, len(tc.signers))
+	for i, signer := range tc.signers {
+		addresses[i] = tc.accounts.address(signer)
+	}
+	return addresses
+}
+
+// verifyCause strips the offending header details off a verification error,
+// returning the reason the header was rejected.
+func verifyCause(err error) error {
+	if herr, ok := err.(*HeaderVerificationError); ok {
+		return herr.Err
+	}
+	return err
+}
+
+// testComposers creates a deterministic list of composers with distinct,
+// non-zero stakes (denominated in whole tokens).
+func testComposers(n int) ([]common.Address, []*big.Int) {
+	addresses := make([]common.Address, n)
+	stakes := make([]*big.Int, n)
+	for i := 0; i < n; i++ {
+		addresses[i] = common.BigToAddress(big.NewInt(int64(i + 1)))
+		stakes[i] = new(big.Int).Mul(big.NewInt(int64(i+1)), big.NewInt(1e18))
+	}
+	return addresses, stakes
+}
+
+// testGovernance is a stub Ethereum endpoint answering every eth_call with the
+// configured composer set, counting and recording the calls served. Head requests
+// are answered with a header stamped with the configured head number and time,
+// whereas other blocks are stamped with testGovernanceBlockTime.
+type testGovernance struct {
+	*httptest.Server
+	calls      int32
+	headNumber uint64
+	headTime   uint64
+
+	queries []testGovernanceQuery
+	lock    sync.Mutex
+}
+
+// testGovernanceQuery is a governance contract call served by testGovernance.
+type testGovernanceQuery struct {
+	block     string   // Ethereum block the call was made at
+	number    *big.Int // Aerum block number the composers were requested for
+	timestamp *big.Int // Lookup timestamp the composers were requested at
+}
+
+// testGovernanceBlockTime returns the timestamp of a non-head block served by
+// testGovernance.
+func testGovernanceBlockTime(number uint64) uint64 {
+	return 1000000 + number*15
+}
+
+// newTestGovernance starts a stub governance endpoint serving the given composers.
+func newTestGovernance(t testing.TB, addresses []common.Address, stakes []*big.Int) *testGovernance {
+	parsed, err := abi.JSON(strings.NewReader(guvnor.AtmosABI))
+	if err != nil {
+		t.Fatalf("failed to parse governance ABI: %v", err)
+	}
+	output, err := parsed.Methods["getComposers"].Outputs.Pack(addresses, stakes)
+	if err != nil {
+		t.Fatalf("failed to pack composers: %v", err)
+	}
+	gov := &testGovernance{headNumber: 1, headTime: uint64(time.Now().Unix())}
+	gov.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ID     json.RawMessage   `json:"id"`
+			Method string            `json:"method"`
+			Params []json.RawMessage `json:"params"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var result interface{}
+		switch req.Method {
+		case "eth_getBlockByNumber":
+			var block string
+			json.Unmarshal(req.Params[0], &block)
+
+			header := &types.Header{
+				Number:     new(big.Int).SetUint64(atomic.LoadUint64(&gov.headNumber)),
+				Difficulty: big.NewInt(1),
+				Time:       atomic.LoadUint64(&gov.headTime),
+			}
+			if block != "latest" {
+				number, _ := hexutil.DecodeUint64(block)
+				header.Number, header.Time = new(big.Int).SetUint64(number), testGovernanceBlockTime(number)
+			}
+			result = header
+		default:
+			atomic.AddInt32(&gov.calls, 1)
+
+			var (
+				call  struct{ Data hexutil.Bytes }
+				query testGovernanceQuery
+			)
+			json.Unmarshal(req.Params[0], &call)
+			json.Unmarshal(req.Params[1], &query.block)
+			if args, err := parsed.Methods["getComposers"].Inputs.UnpackValues(call.Data[4:]); err == nil {
+				query.number, query.timestamp = args[0].(*big.Int), args[1].(*big.Int)
+			}
+			gov.lock.Lock()
+			gov.queries = append(gov.queries, query)
+			gov.lock.Unlock()
+
+			result = hexutil.Bytes(output)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"jsonrpc": "2.0",
+			"id":      req.ID,
+			"result":  result,
+		})
+	}))
+	return gov
+}
+
+// Calls returns the number of contract calls served so far.
+func (gov *testGovernance) Calls() int {
+	return int(atomic.LoadInt32(&gov.calls))
+}
+
+// SetHeadTime sets the timestamp of the head reported by the endpoint.
+func (gov *testGovernance) SetHeadTime(time uint64) {
+	atomic.StoreUint64(&gov.headTime, time)
+}
+
+// SetHeadNumber sets the number of the head reported by the endpoint.
+func (gov *testGovernance) SetHeadNumber(number uint64) {
+	atomic.StoreUint64(&gov.headNumber, number)
+}
+
+// Queries returns the contract calls served so far.
+func (gov *testGovernance) Queries() []testGovernanceQuery {
+	gov.lock.Lock()
+	defer gov.lock.Unlock()
+
+	return append([]testGovernanceQuery(nil), gov.queries...)
+}
+
+// Tests that the probabilistic selection caps the committee at numberOfSigners
+// and only ever picks distinct composers out of the supplied set.
+func TestSignersProbabilisticSelection(t *testing.T) {
+	addresses, stakes := testComposers(25)
+	config := &params.AtmosConfig{SignersPerEpoch: numberOfSigners}
+
+	selected := signersProbabilisticSelection(config, addresses, stakes, 100)
+	if len(selected) != numberOfSigners {
+		t.Fatalf("selected signer count mismatch: have %d, want %d", len(selected), numberOfSigners)
+	}
+	known := make(map[common.Address]bool)
+	for _, address := range addresses {
+		known[address] = true
+	}
+	seen := make(map[common.Address]bool)
+	for _, address := range selected {
+		if !known[address] {
+			t.Errorf("selected unknown composer %x", address)
+		}
+		if seen[address] {
+			t.Errorf("composer %x selected twice", address)
+		}
+		seen[address] = true
+	}
+	// The selection must not mutate the composer list it was given
+	original, _ := testComposers(25)
+	for i := range addresses {
+		if addresses[i] != original[i] {
+			t.Fatalf("composer list mutated at %d: have %x, want %x", i, addresses[i], original[i])
+		}
+	}
+}
+
+// Tests that small composer sets are taken over in full.
+func TestSignersProbabilisticSelectionBelowCap(t *testing.T) {
+	addresses, stakes := testComposers(4)
+	config := &params.AtmosConfig{SignersPerEpoch: numberOfSigners}
+
+	selected := signersProbabilisticSelection(config, addresses, stakes, 100)
+	if len(selected) != len(addresses) {
+		t.Fatalf("selected signer count mismatch: have %d, want %d", len(selected), len(addresses))
+	}
+}
+
+// Tests that degenerate composer sets, empty or without any significant stake,
+// don't crash the selection.
+func TestSignersProbabilisticSelectionDegenerate(t *testing.T) {
+	// An empty composer set selects nobody, even on a zero epoch config
+	for i, config := range []*params.AtmosConfig{{SignersPerEpoch: numberOfSigners}, {}} {
+		selected := signersProbabilisticSelection(config, nil, nil, 100)
+		if selected == nil || len(selected) != 0 {
+			t.Errorf("test %d: empty set selection mismatch: have %v, want []", i, selected)
+		}
+	}
+	// Composers staking less than a token each are still picked, in order
+	addresses, _ := testComposers(12)
+	stakes := make([]*big.Int, len(addresses))
+	for i := range stakes {
+		stakes[i] = big.NewInt(1)
+	}
+	config := &params.AtmosConfig{SignersPerEpoch: numberOfSigners}
+
+	selected := signersProbabilisticSelection(config, addresses, stakes, 100)
+	if !reflect.DeepEqual(selected, addresses[:numberOfSigners]) {
+		t.Errorf("unstaked selection mismatch: have %v, want %v", selected, addresses[:numberOfSigners])
+	}
+}
+
+// Tests that the committee is deterministic for a given epoch block and that it
+// rotates as the chain advances from one epoch to the next.
+func TestSignersProbabilisticSelectionRotation(t *testing.T) {
+	for _, size := range []int{2, 5, 10} {
+		testSignersProbabilisticSelectionRotation(t, size)
+	}
+}
+
+func testSignersProbabilisticSelectionRotation(t *testing.T, size int) {
+	addresses, stakes := testComposers(30)
+	config := &params.AtmosConfig{SignersPerEpoch: size}
+	epoch := params.NewAtmosEpochInterval()
+
+	rotated := false
+	for number := uint64(0); number < 10*epoch; number += epoch {
+		first := signersProbabilisticSelection(config, addresses, stakes, number)
+		if len(first) != size {
+			t.Fatalf("size %d, epoch %d: committee size mismatch: have %d, want %d", size, number/epoch, len(first), size)
+		}
+		second := signersProbabilisticSelection(config, addresses, stakes, number)
+		for i := range first {
+			if first[i] != second[i] {
+				t.Fatalf("size %d, epoch %d: selection not deterministic at %d: %x != %x", size, number/epoch, i, first[i], second[i])
+			}
+		}
+		next := signersProbabilisticSelection(config, addresses, stakes, number+epoch)
+		for i := range first {
+			if first[i] != next[i] {
+				rotated = true
+			}
+		}
+	}
+	if !rotated {
+		t.Fatalf("size %d: committee never rotated across epochs", size)
+	}
+}
+
+// Tests that the signers per epoch defaults when left unset and is raised to the
+// minimum if configured too low.
+func TestSignersPerEpochDefaults(t *testing.T) {
+	tests := []struct {
+		configured int
+		expected   int
+	}{
+		{0, numberOfSigners},
+		{1, minSignersPerEpoch},
+		{-5, minSignersPerEpoch},
+		{2, 2},
+		{25, 25},
+	}
+	for i, tt := range tests {
+		engine := New(&params.AtmosConfig{SignersPerEpoch: tt.configured}, nil)
+		if engine.config.SignersPerEpoch != tt.expected {
+			t.Errorf("test %d: signers per epoch mismatch: have %d, want %d", i, engine.config.SignersPerEpoch, tt.expected)
+		}
+	}
+}
+
+// Tests that a snapshot built from the selected committee authorizes exactly
+// the selected signers and rotates the in-turn slot between all of them.
+func TestSnapshotFromSelectedComposers(t *testing.T) {
+	addresses, stakes := testComposers(25)
+	config := &params.AtmosConfig{Epoch: 100, SignersPerEpoch: numberOfSigners}
+	selected := signersProbabilisticSelection(config, addresses, stakes, 100)
+
+	sigcache, _ := lru.NewARC(inmemorySignatures)
+	snap := newSnapshot(config, sigcache, 100, common.Hash{}, selected)
+
+	if len(snap.Signers) != numberOfSigners {
+		t.Fatalf("snapshot signer count mismatch: have %d, want %d", len(snap.Signers), numberOfSigners)
+	}
+	for _, signer := range selected {
+		if _, ok := snap.Signers[signer]; !ok {
+			t.Errorf("selected signer %x missing from snapshot", signer)
+		}
+	}
+	for number := uint64(101); number < 101+numberOfSigners; number++ {
+		inturn := 0
+		for _, signer := range selected {
+			if snap.inturn(number, signer) {
+				inturn++
+			}
+		}
+		if inturn != 1 {
+			t.Errorf("block %d: in-turn signer count mismatch: have %d, want 1", number, inturn)
+		}
+	}
+}
+
+// Tests that a governance endpoint which never answers makes getComposers fail
+// with a deadline error instead of blocking forever.
+func TestGetComposersTimeout(t *testing.T) {
+	quit := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-quit:
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer srv.Close()
+	defer close(quit)
+
+	engine := New(&params.AtmosConfig{EthereumApiEndpoint: srv.URL, GovernanceCallTimeout: 100 * time.Millisecond}, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), engine.config.GovernanceCallTimeout)
+	defer cancel()
+
+	start := time.Now()
+	_, err := getComposers(ctx, engine.config, 0, big.NewInt(0))
+	if err != context.DeadlineExceeded {
+		t.Fatalf("error mismatch: have %v, want %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("governance call not aborted in time: took %v", elapsed)
+	}
+}
+
+// Tests that the governance call timeout defaults when left unset.
+func TestGovernanceCallTimeoutDefault(t *testing.T) {
+	engine := New(&params.AtmosConfig{}, nil)
+	if engine.config.GovernanceCallTimeout != governanceCallTimeout {
+		t.Fatalf("timeout mismatch: have %v, want %v", engine.config.GovernanceCallTimeout, governanceCallTimeout)
+	}
+}
+
+// Tests that composers are only loaded from governance once per epoch and check
+// timestamp, any subsequent lookups being served from memory.
+func TestLoadComposersCached(t *testing.T) {
+	addresses, stakes := testComposers(25)
+	gov := newTestGovernance(t, addresses, stakes)
+	defer gov.Close()
+
+	engine := New(&params.AtmosConfig{EthereumApiEndpoint: gov.URL}, rawdb.NewMemoryDatabase())
+
+	first, err := engine.epochSigners(context.Background(), nil, 0, nil)
+	if err != nil {
+		t.Fatalf("failed to load composers: %v", err)
+	}
+	if len(first) != numberOfSigners {
+		t.Fatalf("signer count mismatch: have %d, want %d", len(first), numberOfSigners)
+	}
+	second, err := engine.epochSigners(context.Background(), nil, 0, nil)
+	if err != nil {
+		t.Fatalf("failed to load cached composers: %v", err)
+	}
+	if calls := gov.Calls(); calls != 1 {
+		t.Fatalf("governance call count mismatch: have %d, want 1", calls)
+	}
+	for i := range first {
+		if first[i] != second[i] {
+			t.Fatalf("cached signer mismatch at %d: have %x, want %x", i, second[i], first[i])
+		}
+	}
+}
+
+// Tests that the composer cache size defaults when left unset.
+func TestComposersCacheSizeDefault(t *testing.T) {
+	engine := New(&params.AtmosConfig{}, nil)
+	if engine.config.ComposersCacheSize != inmemoryComposers {
+		t.Fatalf("cache size mismatch: have %d, want %d", engine.config.ComposersCacheSize, inmemoryComposers)
+	}
+}
+
+// Tests that negative sealing delays are replaced by the defaults instead of
+// being used for the wiggle or the recents timeout.
+func TestNegativeDurations(t *testing.T) {
+	engine := New(&params.AtmosConfig{WiggleTime: -time.Second, RecentsTimeout: -time.Second}, nil)
+	if engine.config.WiggleTime != wiggleTime {
+		t.Errorf("wiggle time mismatch: have %v, want %v", engine.config.WiggleTime, wiggleTime)
+	}
+	if engine.config.RecentsTimeout != recentsTimeout {
+		t.Errorf("recents timeout mismatch: have %v, want %v", engine.config.RecentsTimeout, recentsTimeout)
+	}
+}
+
+// Tests that the signature and snapshot caches are sized as configured, falling
+// back to the defaults for unset or invalid sizes.
+func TestCacheSizes(t *testing.T) {
+	engine := New(&params.AtmosConfig{SignatureCacheSize: -1, SnapshotCacheSize: -1}, nil)
+	if engine.config.SignatureCacheSize != inmemorySignatures || engine.config.SnapshotCacheSize != inmemorySnapshots {
+		t.Errorf("invalid cache sizes accepted: signatures %d, snapshots %d", engine.config.SignatureCacheSize, engine.config.SnapshotCacheSize)
+	}
+	chain := newTesterChain(t, &params.AtmosConfig{Period: 1, Epoch: 30000, SignatureCacheSize: 2, SnapshotCacheSize: 3}, []string{"A", "B", "C"}, 5)
+	defer chain.Stop()
+
+	// Recovering more signers than the cache holds must evict the oldest ones
+	engine = chain.engine
+	engine.signatures.Purge()
+	for number := uint64(1); number <= 5; number++ {
+		if _, err := ecrecover(chain.GetHeaderByNumber(number), engine.signatures, nil); err != nil {
+			t.Fatalf("block %d: failed to recover signer: %v", number, err)
+		}
+	}
+	if size := engine.signatures.Len(); size != 2 {
+		t.Errorf("signature cache size mismatch: have %d, want %d", size, 2)
+	}
+	for number := uint64(1); number <= 5; number++ {
+		cached := engine.signatures.Contains(chain.GetHeaderByNumber(number).Hash())
+		if want := number > 3; cached != want {
+			t.Errorf("block %d: signature cache hit mismatch: have %v, want %v", number, cached, want)
+		}
+	}
+	if size := engine.recents.Len(); size > 3 {
+		t.Errorf("snapshot cache size mismatch: have %d, want <= %d", size, 3)
+	}
+}
+
+func BenchmarkLoadComposersCached(b *testing.B) {
+	addresses, stakes := testComposers(25)
+	gov := newTestGovernance(b, addresses, stakes)
+	defer gov.Close()
+
+	engine := New(&params.AtmosConfig{EthereumApiEndpoint: gov.URL}, rawdb.NewMemoryDatabase())
+	if _, err := engine.epochSigners(context.Background(), nil, 0, nil); err != nil {
+		b.Fatalf("failed to load composers: %v", err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		engine.epochSigners(context.Background(), nil, 0, nil)
+	}
+}
+
+func BenchmarkLoadComposersUncached(b *testing.B) {
+	addresses, stakes := testComposers(25)
+	gov := newTestGovernance(b, addresses, stakes)
+	defer gov.Close()
+
+	engine := New(&params.AtmosConfig{EthereumApiEndpoint: gov.URL}, nil)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		engine.db = rawdb.NewMemoryDatabase()
+		engine.composers.Purge()
+		engine.epochSigners(context.Background(), nil, 0, nil)
+	}
+}
+
+// Tests that governance lookups fall back to the next configured endpoint if an
+// earlier one fails.
+func TestGetComposersFallback(t *testing.T) {
+	failures := int32(0)
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&failures, 1)
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer broken.Close()
+
+	addresses, stakes := testComposers(25)
+	gov := newTestGovernance(t, addresses, stakes)
+	defer gov.Close()
+
+	config := New(&params.AtmosConfig{EthereumApiEndpoints: []string{broken.URL, gov.URL}}, nil).config
+	signers, err := getComposers(context.Background(), config, 0, big.NewInt(0))
+	if err != nil {
+		t.Fatalf("failed to load composers: %v", err)
+	}
+	if atomic.LoadInt32(&failures) == 0 {
+		t.Fatalf("first endpoint was never tried")
+	}
+	if gov.Calls() != 1 {
+		t.Fatalf("fallback endpoint call count mismatch: have %d, want 1", gov.Calls())
+	}
+	want := signersProbabilisticSelection(config, addresses, stakes, 0)
+	if len(signers) != len(want) {
+		t.Fatalf("signer count mismatch: have %d, want %d", len(signers), len(want))
+	}
+	for i := range want {
+		if signers[i] != want[i] {
+			t.Errorf("signer %d mismatch: have %x, want %x", i, signers[i], want[i])
+		}
+	}
+}
+
+// Tests that the legacy single endpoint is tried before the fallback list.
+func TestEthereumApiEndpointsOrder(t *testing.T) {
+	config := &params.AtmosConfig{
+		EthereumApiEndpoint:  "http://primary",
+		EthereumApiEndpoints: []string{"http://primary", "http://secondary"},
+	}
+	endpoints := getEthereumApiEndpoints(config)
+	if len(endpoints) != 2 || endpoints[0] != "http://primary" || endpoints[1] != "http://secondary" {
+		t.Fatalf("endpoint list mismatch: have %v", endpoints)
+	}
+}
+
+// Tests that recent signers are rejected outright by default, but are allowed to
+// seal once the recents timeout passed if the timeout is enforced instead.
+func TestRecentSignerTimeout(t *testing.T) {
+	tests := []struct {
+		enforce bool
+		timeout time.Duration
+		delay   uint64
+		failure error
+	}{
+		{enforce: false, delay: 10, failure: errRecentlySigned},
+		{enforce: false, delay: 60, failure: errRecentlySigned},
+		{enforce: true, delay: 10, failure: ErrInvalidTimestamp},
+		{enforce: true, delay: uint64(recentsTimeout/time.Second) - 1, failure: ErrInvalidTimestamp},
+		{enforce: true, delay: uint64(recentsTimeout / time.Second), failure: nil},
+		{enforce: true, timeout: 5 * time.Second, delay: 4, failure: ErrInvalidTimestamp},
+		{enforce: true, timeout: 5 * time.Second, delay: 5, failure: nil},
+	}
+	for i, tt := range tests {
+		chain := newTesterChain(t, &params.AtmosConfig{Period: 1, Epoch: 30000, EnforceRecentTimeout: tt.enforce, RecentsTimeout: tt.timeout}, []string{"A", "B", "C"}, 3)
+
+		// Block 3 was sealed by the first signer, make it seal block 4 too
+		parent := chain.CurrentHeader()
+		recent := chain.inturn(3)
+		blocks := chain.generate(1, func(uint64) string { return recent }, func(header *types.Header) {
+			header.Time = parent.Time + tt.delay
+		})
+		if _, err := chain.InsertChain(blocks); verifyCause(err) != tt.failure {
+			t.Errorf("test %d: failure mismatch: have %v, want %v", i, err, tt.failure)
+		}
+		chain.Stop()
+	}
+}
+
+// Tests that preparing a block for a recent signer pushes its timestamp out by
+// the recents timeout if the timeout is enforced.
+func TestPrepareRecentTimeout(t *testing.T) {
+	chain := newTesterChain(t, &params.AtmosConfig{Period: 1, Epoch: 30000, EnforceRecentTimeout: true}, []string{"A", "B", "C"}, 0)
+	defer chain.Stop()
+
+	// Produce a few blocks right up to the current time
+	base := uint64(time.Now().Unix()) - 10
+	blocks := chain.generate(3, chain.inturn, func(header *types.Header) {
+		header.Time = base + header.Number.Uint64()
+	})
+	if k, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to import block %d: %v", k, err)
+	}
+	parent := chain.CurrentHeader()
+	timeout := parent.Time + uint64(chain.engine.config.RecentsTimeout/time.Second)
+
+	// A recent signer must have its block pushed out, an in-turn one must not
+	chain.engine.Authorize(chain.accounts.address(chain.inturn(3)), nil)
+	header := &types.Header{ParentHash: parent.Hash(), Number: big.NewInt(4)}
+	if err := chain.engine.Prepare(chain, header); err != nil {
+		t.Fatalf("failed to prepare header: %v", err)
+	}
+	if header.Time < timeout {
+		t.Errorf("recent signer block time mismatch: have %d, want >= %d", header.Time, timeout)
+	}
+	chain.engine.Authorize(chain.accounts.address(chain.inturn(4)), nil)
+	header = &types.Header{ParentHash: parent.Hash(), Number: big.NewInt(4)}
+	if err := chain.engine.Prepare(chain, header); err != nil {
+		t.Fatalf("failed to prepare header: %v", err)
+	}
+	if header.Time >= timeout {
+		t.Errorf("in-turn signer block time mismatch: have %d, want < %d", header.Time, timeout)
+	}
+}
+
+// Tests that sealing blocks accounts for them in the in-turn and out-of-turn
+// seal counters.
+func TestSealMetrics(t *testing.T) {
+	defer func(inturn, noturn metrics.Counter) {
+		sealInTurnCounter, sealNoTurnCounter = inturn, noturn
+	}(sealInTurnCounter, sealNoTurnCounter)
+	sealInTurnCounter, sealNoTurnCounter = metrics.NewCounterForced(), metrics.NewCounterForced()
+
+	chain := newTesterChain(t, &params.AtmosConfig{Period: 1, Epoch: 30000}, []string{"A", "B", "C"}, 1)
+	defer chain.Stop()
+
+	seal := func(signer string) {
+		chain.engine.Authorize(chain.accounts.address(signer), chain.accounts.signFn(signer))
+
+		parent := chain.CurrentHeader()
+		header := &types.Header{ParentHash: parent.Hash(), Number: new(big.Int).Add(parent.Number, common.Big1)}
+		if err := chain.engine.Prepare(chain, header); err != nil {
+			t.Fatalf("failed to prepare header: %v", err)
+		}
+		stop := make(chan struct{})
+		defer close(stop)
+		if err := chain.engine.Seal(chain, types.NewBlockWithHeader(header), make(chan *types.Block, 1), stop); err != nil {
+			t.Fatalf("failed to seal block: %v", err)
+		}
+	}
+	seal(chain.inturn(2))
+	seal(chain.inturn(2))
+	seal(chain.inturn(3))
+
+	if have := sealInTurnCounter.Count(); have != 2 {
+		t.Errorf("in-turn seal count mismatch: have %d, want %d", have, 2)
+	}
+	if have := sealNoTurnCounter.Count(); have != 1 {
+		t.Errorf("out-of-turn seal count mismatch: have %d, want %d", have, 1)
+	}
+}
+
+// Tests that failed governance lookups are retried with an exponential backoff
+// until one of them succeeds.
+func TestGetComposersRetry(t *testing.T) {
+	addresses, stakes := testComposers(25)
+	gov := newTestGovernance(t, addresses, stakes)
+	defer gov.Close()
+
+	// Fail the first two dials, letting the third one through
+	dials := 0
+	defer func(dial func(context.Context, string) (*ethclient.Client, error)) {
+		dialEthereum = dial
+	}(dialEthereum)
+	dialEthereum = func(ctx context.Context, endpoint string) (*ethclient.Client, error) {
+		if dials++; dials <= 2 {
+			return nil, errors.New("connection refused")
+		}
+		return ethclient.DialContext(ctx, endpoint)
+	}
+	config := New(&params.AtmosConfig{EthereumApiEndpoint: gov.URL}, nil).config
+
+	start := time.Now()
+	signers, err := getComposers(context.Background(), config, 0, big.NewInt(0))
+	if err != nil {
+		t.Fatalf("failed to load composers: %v", err)
+	}
+	elapsed := time.Since(start)
+
+	if dials != 3 {
+		t.Errorf("dial count mismatch: have %d, want %d", dials, 3)
+	}
+	if len(signers) != numberOfSigners {
+		t.Errorf("signer count mismatch: have %d, want %d", len(signers), numberOfSigners)
+	}
+	// The two failures must have been backed off by the initial and the doubled delay
+	if wait := 3 * governanceRetryDelay; elapsed < wait || elapsed > wait+time.Second {
+		t.Errorf("retry wait mismatch: have %v, want %v", elapsed, wait)
+	}
+}
+
+// Tests that governance lookups are made against the latest Ethereum state at the
+// lookup timestamp by default, but against the pinned block and its timestamp if
+// one is configured.
+func TestGetComposersPinnedBlock(t *testing.T) {
+	addresses, stakes := testComposers(25)
+
+	tests := []struct {
+		pinned    *big.Int
+		block     string
+		timestamp uint64
+	}{
+		{nil, "latest", 1234},
+		{big.NewInt(50), "0x32", testGovernanceBlockTime(50)},
+		{big.NewInt(100), "0x64", testGovernanceBlockTime(100)},
+	}
+	for i, tt := range tests {
+		gov := newTestGovernance(t, addresses, stakes)
+		gov.SetHeadNumber(100)
+
+		config := New(&params.AtmosConfig{EthereumApiEndpoint: gov.URL, GovernanceRetries: -1, GovernancePinnedBlock: tt.pinned}, nil).config
+		if _, err := getComposers(context.Background(), config, 30000, big.NewInt(1234)); err != nil {
+			t.Fatalf("test %d: failed to load composers: %v", i, err)
+		}
+		queries := gov.Queries()
+		gov.Close()
+
+		if len(queries) != 1 {
+			t.Fatalf("test %d: query count mismatch: have %d, want %d", i, len(queries), 1)
+		}
+		if queries[0].block != tt.block {
+			t.Errorf("test %d: queried block mismatch: have %s, want %s", i, queries[0].block, tt.block)
+		}
+		if queries[0].number == nil || queries[0].number.Uint64() != 30000 {
+			t.Errorf("test %d: queried number mismatch: have %v, want %d", i, queries[0].number, 30000)
+		}
+		if queries[0].timestamp == nil || queries[0].timestamp.Uint64() != tt.timestamp {
+			t.Errorf("test %d: queried timestamp mismatch: have %v, want %d", i, queries[0].timestamp, tt.timestamp)
+		}
+	}
+	// A block pinned beyond the endpoint's head must not be queried
+	gov := newTestGovernance(t, addresses, stakes)
+	defer gov.Close()
+
+	config := New(&params.AtmosConfig{EthereumApiEndpoint: gov.URL, GovernanceRetries: -1, GovernancePinnedBlock: big.NewInt(2)}, nil).config
+	if _, err := getComposers(context.Background(), config, 30000, big.NewInt(1234)); err != errGovernanceNodeBehind {
+		t.Errorf("error mismatch: have %v, want %v", err, errGovernanceNodeBehind)
+	}
+	if calls := gov.Calls(); calls != 0 {
+		t.Errorf("governance queried beyond the head: %d calls", calls)
+	}
+}
+
+// Tests that governance lookups with a confirmation depth are only made once the
+// lookup timestamp is buried under that many Ethereum blocks, and are still made
+// against the latest state at the lookup timestamp derived from the chain.
+func TestGetComposersConfirmations(t *testing.T) {
+	addresses, stakes := testComposers(25)
+
+	tests := []struct {
+		confirmations uint64
+		timestamp     uint64
+		behind        bool
+	}{
+		{0, testGovernanceBlockTime(99), false},
+		{10, testGovernanceBlockTime(90), false},
+		{11, testGovernanceBlockTime(90), true},
+		{100, testGovernanceBlockTime(0), false},
+		{101, testGovernanceBlockTime(0), true},
+	}
+	for i, tt := range tests {
+		gov := newTestGovernance(t, addresses, stakes)
+		gov.SetHeadNumber(100)
+		gov.SetHeadTime(testGovernanceBlockTime(100))
+
+		config := New(&params.AtmosConfig{EthereumApiEndpoint: gov.URL, GovernanceRetries: -1, GovernanceConfirmations: tt.confirmations}, nil).config
+		_, err := getComposers(context.Background(), config, 30000, new(big.Int).SetUint64(tt.timestamp))
+		queries := gov.Queries()
+		gov.Close()
+
+		if tt.behind {
+			if err != errGovernanceNodeBehind {
+				t.Errorf("test %d: error mismatch: have %v, want %v", i, err, errGovernanceNodeBehind)
+			}
+			if len(queries) != 0 {
+				t.Errorf("test %d: governance queried with too few confirmations: %d calls", i, len(queries))
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("test %d: failed to load composers: %v", i, err)
+		}
+		if len(queries) != 1 {
+			t.Fatalf("test %d: query count mismatch: have %d, want %d", i, len(queries), 1)
+		}
+		if queries[0].block != "latest" {
+			t.Errorf("test %d: queried block mismatch: have %s, want %s", i, queries[0].block, "latest")
+		}
+		if queries[0].timestamp == nil || queries[0].timestamp.Uint64() != tt.timestamp {
+			t.Errorf("test %d: queried timestamp mismatch: have %v, want %d", i, queries[0].timestamp, tt.timestamp)
+		}
+	}
+}
+
+// Tests that governance retries are aborted as soon as the context is cancelled.
+func TestGetComposersRetryAbort(t *testing.T) {
+	config := New(&params.AtmosConfig{EthereumApiEndpoint: unreachableEndpoint(), GovernanceRetries: 10}, nil).config
+
+	ctx, cancel := context.WithTimeout(context.Background(), governanceRetryDelay/2)
+	defer cancel()
+
+	start := time.Now()
+	if _, err := getComposers(ctx, config, 0, big.NewInt(0)); err != context.DeadlineExceeded {
+		t.Fatalf("error mismatch: have %v, want %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > governanceRetryDelay {
+		t.Fatalf("retries not aborted in time: took %v", elapsed)
+	}
+}
+
+// Tests that the block reward configured in the chain config is credited to the
+// signers of imported blocks, falling back to the default if left unset.
+func TestBlockReward(t *testing.T) {
+	tests := []struct {
+		reward *big.Int
+		want   *big.Int
+	}{
+		{nil, params.NewAtmosBlockRewards()},
+		{big.NewInt(1), big.NewInt(1)},
+		{new(big.Int).Mul(big.NewInt(5), big.NewInt(1e18)), new(big.Int).Mul(big.NewInt(5), big.NewInt(1e18))},
+	}
+	for i, tt := range tests {
+		chain := newTesterChain(t, &params.AtmosConfig{Period: 1, Epoch: 30000, BlockReward: tt.reward}, []string{"A", "B"}, 3)
+
+		state, err := chain.State()
+		if err != nil {
+			t.Fatalf("test %d: failed to retrieve state: %v", i, err)
+		}
+		// Blocks 1 and 3 were sealed by the same signer, block 2 by the other
+		first, second := chain.accounts.address(chain.inturn(1)), chain.accounts.address(chain.inturn(2))
+		if have, want := state.GetBalance(first), new(big.Int).Mul(tt.want, big.NewInt(2)); have.Cmp(want) != 0 {
+			t.Errorf("test %d: first signer balance mismatch: have %v, want %v", i, have, want)
+		}
+		if have := state.GetBalance(second); have.Cmp(tt.want) != 0 {
+			t.Errorf("test %d: second signer balance mismatch: have %v, want %v", i, have, tt.want)
+		}
+		chain.Stop()
+	}
+}
+
+// Tests that the network parameters replaced by an embedding library before the
+// engine is created are the ones the engine defaults to.
+func TestCustomNetworkParams(t *testing.T) {
+	defaults := params.GetAtmosParams()
+	defer params.SetAtmosParams(defaults)
+
+	custom := defaults
+	custom.EpochInterval, custom.BlockInterval, custom.BlockRewards = 77, 9, big.NewInt(42)
+	if err := params.SetAtmosParams(custom); err != nil {
+		t.Fatalf("failed to set network parameters: %v", err)
+	}
+	engine := New(&params.AtmosConfig{StrictRulesBlock: common.Big0}, nil)
+	if engine.config.Epoch != 77 {
+		t.Errorf("epoch mismatch: have %d, want %d", engine.config.Epoch, 77)
+	}
+	if period := engine.blockPeriod(1); period != 9 {
+		t.Errorf("period mismatch: have %d, want %d", period, 9)
+	}
+	if reward := engine.blockReward(common.Big1); reward.Cmp(big.NewInt(42)) != 0 {
+		t.Errorf("reward mismatch: have %v, want %d", reward, 42)
+	}
+}
+
+// Tests that the block reward halves every configured interval, flooring at zero.
+func TestBlockRewardHalving(t *testing.T) {
+	engine := New(&params.AtmosConfig{BlockReward: big.NewInt(1000), RewardHalvingInterval: 100}, nil)
+
+	tests := []struct {
+		number uint64
+		reward int64
+	}{
+		{0, 1000},
+		{99, 1000},
+		{100, 500},
+		{199, 500},
+		{200, 250},
+		{900, 1},
+		{1000, 0},
+		{100 * 1000000, 0},
+	}
+	for i, tt := range tests {
+		if have := engine.blockReward(new(big.Int).SetUint64(tt.number)); have.Int64() != tt.reward {
+			t.Errorf("test %d: block %d reward mismatch: have %v, want %d", i, tt.number, have, tt.reward)
+		}
+	}
+	// The configured base reward must not be modified by the halving
+	if engine.config.BlockReward.Int64() != 1000 {
+		t.Errorf("base reward modified: have %v, want %d", engine.config.BlockReward, 1000)
+	}
+	// Without an interval the reward stays constant
+	engine = New(&params.AtmosConfig{BlockReward: big.NewInt(1000)}, nil)
+	if have := engine.blockReward(big.NewInt(1000000)); have.Int64() != 1000 {
+		t.Errorf("constant reward mismatch: have %v, want %d", have, 1000)
+	}
+}
+
+// Tests that the halved block rewards are the ones credited to block signers.
+func TestBlockRewardHalvingCredited(t *testing.T) {
+	chain := newTesterChain(t, &params.AtmosConfig{Period: 1, Epoch: 30000, BlockReward: big.NewInt(8), RewardHalvingInterval: 2}, []string{"A", "B"}, 5)
+	defer chain.Stop()
+
+	state, err := chain.State()
+	if err != nil {
+		t.Fatalf("failed to retrieve state: %v", err)
+	}
+	// First signer sealed blocks 1, 3 and 5, the second one blocks 2 and 4
+	first, second := chain.accounts.address(chain.inturn(1)), chain.accounts.address(chain.inturn(2))
+	if have := state.GetBalance(first); have.Int64() != 8+4+2 {
+		t.Errorf("first signer balance mismatch: have %v, want %d", have, 8+4+2)
+	}
+	if have := state.GetBalance(second); have.Int64() != 4+2 {
+		t.Errorf("second signer balance mismatch: have %v, want %d", have, 4+2)
+	}
+}
+
+// Tests that checkpoint blocks are only rewarded if the chain config doesn't opt
+// out of it, while regular blocks are always rewarded.
+func TestRewardEpochBlocks(t *testing.T) {
+	enabled, disabled := true, false
+
+	tests := []struct {
+		reward *bool
+		number int64
+		want   int64
+	}{
+		{nil, 10, 1},
+		{nil, 11, 1},
+		{&enabled, 10, 1},
+		{&enabled, 11, 1},
+		{&disabled, 10, 0},
+		{&disabled, 11, 1},
+		{&disabled, 20, 0},
+	}
+	for i, tt := range tests {
+		engine := New(&params.AtmosConfig{Epoch: 10, BlockReward: big.NewInt(1), RewardEpochBlocks: tt.reward}, nil)
+
+		statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()))
+		signer := common.Address{0x01}
+
+		accumulateRewards(engine, statedb, &types.Header{Number: big.NewInt(tt.number)}, signer)
+		if have := statedb.GetBalance(signer); have.Int64() != tt.want {
+			t.Errorf("test %d: block %d reward mismatch: have %v, want %d", i, tt.number, have, tt.want)
+		}
+	}
+}
+
+// Tests that signers are only rewarded if they hold the minimum balance required
+// by the chain config, if any.
+func TestMinSignerBalance(t *testing.T) {
+	tests := []struct {
+		min     *big.Int
+		balance int64
+		want    int64
+	}{
+		{nil, 0, 1},
+		{big.NewInt(100), 0, 0},
+		{big.NewInt(100), 99, 99},
+		{big.NewInt(100), 100, 101},
+		{big.NewInt(100), 1000, 1001},
+	}
+	for i, tt := range tests {
+		engine := New(&params.AtmosConfig{BlockReward: big.NewInt(1), MinSignerBalance: tt.min}, nil)
+
+		statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()))
+		signer := common.Address{0x01}
+		statedb.SetBalance(signer, big.NewInt(tt.balance))
+
+		accumulateRewards(engine, statedb, &types.Header{Number: big.NewInt(1)}, signer)
+		if have := statedb.GetBalance(signer); have.Int64() != tt.want {
+			t.Errorf("test %d: signer balance mismatch: have %v, want %d", i, have, tt.want)
+		}
+	}
+}
+
+// Tests that a zero block reward leaves the state untouched, as if rewards were
+// not accumulated at all.
+func TestZeroBlockReward(t *testing.T) {
+	signer := common.Address{0x01}
+
+	for i, config := range []*params.AtmosConfig{
+		{BlockReward: big.NewInt(0)},
+		{BlockReward: big.NewInt(1), RewardHalvingInterval: 1},
+	} {
+		engine := New(config, nil)
+
+		rewarded, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()))
+		accumulateRewards(engine, rewarded, &types.Header{Number: big.NewInt(10)}, signer)
+
+		untouched, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()))
+
+		if have := rewarded.GetBalance(signer); have.Sign() != 0 {
+			t.Errorf("test %d: signer balance mismatch: have %v, want 0", i, have)
+		}
+		if rewarded.Exist(signer) {
+			t.Errorf("test %d: signer account touched", i)
+		}
+		if have, want := rewarded.IntermediateRoot(false), untouched.IntermediateRoot(false); have != want {
+			t.Errorf("test %d: state root mismatch: have %x, want %x", i, have, want)
+		}
+	}
+}
+
+// Tests that a configured treasury cut splits the block reward between the signer
+// and the treasury, the two shares always summing up to the full reward.
+func TestTreasuryReward(t *testing.T) {
+	var (
+		signer   = common.Address{0x01}
+		treasury = common.Address{0x02}
+		reward   = big.NewInt(1000000007)
+	)
+	tests := []struct {
+		bps      uint64
+		treasury *big.Int
+	}{
+		{0, big.NewInt(0)},
+		{1000, big.NewInt(100000000)}, // floor of 100000000.7
+		{10000, reward},
+	}
+	for i, tt := range tests {
+		engine := New(&params.AtmosConfig{BlockReward: reward, TreasuryAddress: treasury, TreasuryRewardBps: tt.bps}, nil)
+
+		statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()))
+		accumulateRewards(engine, statedb, &types.Header{Number: big.NewInt(10)}, signer)
+
+		if have := statedb.GetBalance(treasury); have.Cmp(tt.treasury) != 0 {
+			t.Errorf("test %d: treasury balance mismatch: have %v, want %v", i, have, tt.treasury)
+		}
+		if have, want := statedb.GetBalance(signer), new(big.Int).Sub(reward, tt.treasury); have.Cmp(want) != 0 {
+			t.Errorf("test %d: signer balance mismatch: have %v, want %v", i, have, want)
+		}
+		if tt.bps == 10000 && statedb.Exist(signer) {
+			t.Errorf("test %d: signer account touched without a reward", i)
+		}
+	}
+	// Cuts beyond the full reward or without a treasury are disabled
+	for i, config := range []*params.AtmosConfig{
+		{TreasuryAddress: treasury, TreasuryRewardBps: 10001},
+		{TreasuryRewardBps: 1000},
+	} {
+		if engine := New(config, nil); engine.config.TreasuryRewardBps != 0 {
+			t.Errorf("invalid config %d: treasury cut accepted: %d bps", i, engine.config.TreasuryRewardBps)
+		}
+	}
+}
+
+// Tests that chains enforcing the coinbase to be the signer reject blocks naming a
+// different beneficiary, and prepare blocks naming the local signer.
+func TestEnforceCoinbaseIsSigner(t *testing.T) {
+	chain := newTesterChain(t, &params.AtmosConfig{Period: 1, Epoch: 30000, EnforceCoinbaseIsSigner: true, AllowLocalProposals: true}, []string{"A", "B", "C"}, 0)
+	defer chain.Stop()
+
+	blocks := chain.generate(2, chain.inturn, func(header *types.Header) {
+		header.Coinbase = chain.accounts.address(chain.inturn(header.Number.Uint64()))
+	})
+	if k, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to import block %d: %v", k, err)
+	}
+	for _, coinbase := range []common.Address{{}, {0xff}, chain.accounts.address(chain.inturn(2))} {
+		blocks = chain.generate(1, chain.inturn, func(header *types.Header) {
+			header.Coinbase = coinbase
+		})
+		if _, err := chain.InsertChain(blocks); verifyCause(err) != errCoinbaseNotSigner {
+			t.Errorf("coinbase %x: error mismatch: have %v, want %v", coinbase, err, errCoinbaseNotSigner)
+		}
+	}
+	// Prepared blocks must name the local signer regardless of pending proposals
+	signer := chain.accounts.address(chain.inturn(3))
+	chain.engine.Authorize(signer, nil)
+	chain.engine.proposals[common.Address{0xff}] = true
+
+	parent := chain.CurrentHeader()
+	header := &types.Header{ParentHash: parent.Hash(), Number: big.NewInt(3)}
+	if err := chain.engine.Prepare(chain, header); err != nil {
+		t.Fatalf("failed to prepare header: %v", err)
+	}
+	if header.Coinbase != signer {
+		t.Errorf("prepared coinbase mismatch: have %x, want %x", header.Coinbase, signer)
+	}
+}
+
+// Tests that chains running with static signers carry the genesis signers across
+// epochs without ever reaching out to governance.
+func TestStaticSigners(t *testing.T) {
+	chain := newTesterChain(t, &params.AtmosConfig{Period: 1, Epoch: 3, StaticSigners: true}, []string{"A", "B", "C"}, 0)
+	defer chain.Stop()
+
+	source := NewFakeComposerSource(nil)
+	chain.engine.SetComposerSource(source)
+
+	// Drive the chain through several epochs, each checkpoint embedding the signers
+	chain.extend(t, 10)
+
+	for number := uint64(3); number <= 9; number += 3 {
+		header := chain.GetHeaderByNumber(number)
+		snap, err := chain.engine.snapshot(chain, number, header.Hash(), nil)
+		if err != nil {
+			t.Fatalf("epoch %d: failed to retrieve snapshot: %v", number, err)
+		}
+		if signers := snap.signers(); !reflect.DeepEqual(signers, chain.addresses()) {
+			t.Errorf("epoch %d: signers mismatch: have %v, want %v", number, signers, chain.addresses())
+		}
+	}
+	if calls := source.Calls(); calls != 0 {
+		t.Errorf("composer source queried %d times", calls)
+	}
+	if _, err := chain.engine.epochSigners(context.Background(), chain, 3, nil); err != errStaticSigners {
+		t.Errorf("governance lookup error mismatch: have %v, want %v", err, errStaticSigners)
+	}
+}
+
+// Tests that epoch snapshots loaded from governance carry the same recent signers
+// as ones rebuilt by replaying the headers, so both agree on who may seal next.
+func TestGovernanceSnapshotRecents(t *testing.T) {
+	accounts := newTesterAccountPool()
+
+	replayed := newTesterChainWithAccounts(t, &params.AtmosConfig{Period: 1, Epoch: 3, StaticSigners: true}, accounts, []string{"A", "B", "C"}, 0)
+	defer replayed.Stop()
+	replayed.extend(t, 3)
+
+	governed := newTesterChainWithAccounts(t, &params.AtmosConfig{Period: 1, Epoch: 3, StrictRulesBlock: common.Big0}, accounts, []string{"A", "B", "C"}, 0)
+	defer governed.Stop()
+	governed.engine.SetComposerSource(NewFakeComposerSource(map[uint64][]common.Address{3: governed.addresses()}))
+	governed.extend(t, 3)
+
+	want, err := replayed.engine.snapshot(replayed, 3, replayed.CurrentHeader().Hash(), nil)
+	if err != nil {
+		t.Fatalf("failed to retrieve replayed snapshot: %v", err)
+	}
+	have, err := governed.engine.snapshot(governed, 3, governed.CurrentHeader().Hash(), nil)
+	if err != nil {
+		t.Fatalf("failed to retrieve governance snapshot: %v", err)
+	}
+	if !reflect.DeepEqual(have.Recents, want.Recents) {
+		t.Errorf("recent signers mismatch: have %v, want %v", have.Recents, want.Recents)
+	}
+	for _, signer := range governed.addresses() {
+		if have.inturn(4, signer) != want.inturn(4, signer) {
+			t.Errorf("signer %x: in-turn mismatch", signer)
+		}
+		if have.recentlySigned(4, signer) != want.recentlySigned(4, signer) {
+			t.Errorf("signer %x: recently signed mismatch", signer)
+		}
+	}
+	// The signer of the epoch block must not be able to seal right after it
+	blocks := governed.generate(1, func(uint64) string { return governed.inturn(3) }, nil)
+	if _, err := governed.InsertChain(blocks); verifyCause(err) != errRecentlySigned {
+		t.Errorf("recent epoch signer error mismatch: have %v, want %v", err, errRecentlySigned)
+	}
+}
+
+// Tests that verification failures identify the offending header, while still
+// matching the underlying error.
+func TestHeaderVerificationError(t *testing.T) {
+	chain := newTesterChain(t, &params.AtmosConfig{Period: 1, Epoch: 30000}, []string{"A", "B", "C"}, 2)
+	defer chain.Stop()
+
+	blocks := chain.generate(2, func(number uint64) string {
+		if number == 4 {
+			return "X" // Outsider to the signer set
+		}
+		return chain.inturn(number)
+	}, nil)
+	headers := []*types.Header{blocks[0].Header(), blocks[1].Header()}
+	bad := headers[1]
+
+	_, results := chain.engine.VerifyHeaders(chain, headers, []bool{true, true})
+	if err := <-results; err != nil {
+		t.Fatalf("failed to verify valid header: %v", err)
+	}
+	batch := <-results
+	if _, err := chain.InsertChain(blocks[:1]); err != nil {
+		t.Fatalf("failed to import valid block: %v", err)
+	}
+	for name, err := range map[string]error{
+		"batch":  batch,
+		"header": chain.engine.VerifyHeader(chain, bad, true),
+		"seal":   chain.engine.VerifySeal(chain, bad),
+	} {
+		if verifyCause(err) != errUnauthorizedSigner {
+			t.Errorf("%s: error mismatch: have %v, want %v", name, err, errUnauthorizedSigner)
+		}
+		herr, ok := err.(*HeaderVerificationError)
+		if !ok {
+			t.Errorf("%s: error doesn't identify the header: %v", name, err)
+			continue
+		}
+		if herr.Number != 4 || herr.Hash != bad.Hash() {
+			t.Errorf("%s: header mismatch: have #%d [%x], want #%d [%x]", name, herr.Number, herr.Hash, 4, bad.Hash())
+		}
+		if cause := herr.Unwrap(); cause != errUnauthorizedSigner {
+			t.Errorf("%s: unwrapped error mismatch: have %v, want %v", name, cause, errUnauthorizedSigner)
+		}
+	}
+	// Errors the chain reacts to by identity must be passed through untouched
+	orphan := types.CopyHeader(headers[0])
+	orphan.ParentHash = common.Hash{0xff}
+	if err := chain.engine.VerifyHeader(chain, orphan, true); err != consensus.ErrUnknownAncestor {
+		t.Errorf("orphan error mismatch: have %v, want %v", err, consensus.ErrUnknownAncestor)
+	}
+}
+
+// Tests that seals can be checked against a trusted signer set without any
+// snapshot, rejecting outsiders and broken seals.
+func TestVerifySealAgainstSigners(t *testing.T) {
+	accounts := newTesterAccountPool()
+	engine := New(&params.AtmosConfig{}, nil)
+
+	trusted := []common.Address{accounts.address("A"), accounts.address("B")}
+	newHeader := func(signer string) *types.Header {
+		header := &types.Header{
+			Number:     big.NewInt(100),
+			Difficulty: diffNoTurn,
+			Extra:      make([]byte, extraVanity+extraSeal),
+		}
+		accounts.sign(header, signer)
+		return header
+	}
+	for _, signer := range []string{"A", "B"} {
+		if err := engine.VerifySealAgainstSigners(newHeader(signer), trusted); err != nil {
+			t.Errorf("signer %s: trusted seal rejected: %v", signer, err)
+		}
+	}
+	if err := engine.VerifySealAgainstSigners(newHeader("C"), trusted); err != errUnauthorizedSigner {
+		t.Errorf("untrusted seal error mismatch: have %v, want %v", err, errUnauthorizedSigner)
+	}
+	if err := engine.VerifySealAgainstSigners(newHeader("A"), nil); err != errUnauthorizedSigner {
+		t.Errorf("empty set error mismatch: have %v, want %v", err, errUnauthorizedSigner)
+	}
+	if err := engine.VerifySealAgainstSigners(&types.Header{Number: big.NewInt(1)}, trusted); err != errMissingSignature {
+		t.Errorf("unsealed header error mismatch: have %v, want %v", err, errMissingSignature)
+	}
+	if err := engine.VerifySealAgainstSigners(&types.Header{Number: big.NewInt(0)}, trusted); err != errUnknownBlock {
+		t.Errorf("genesis error mismatch: have %v, want %v", err, errUnknownBlock)
+	}
+}
+
+// Tests that failed governance lookups fall back to the last loaded signers
+// within the configured grace period, but fail beyond it.
+func TestGovernanceGracePeriod(t *testing.T) {
+	chain := newTesterChain(t, &params.AtmosConfig{Period: 1, Epoch: 3, GovernanceGracePeriodEpochs: 1}, []string{"A", "B", "C"}, 0)
+	defer chain.Stop()
+
+	// Only serve the committee for the first epoch, failing all later ones
+	committee := chain.addresses()
+	chain.engine.SetComposerSource(NewFakeComposerSource(map[uint64][]common.Address{3: committee}))
+
+	// The second epoch is within the grace period, so it must keep the committee
+	chain.extend(t, 7)
+
+	header := chain.GetHeaderByNumber(6)
+	snap, err := chain.engine.snapshot(chain, 6, header.Hash(), nil)
+	if err != nil {
+		t.Fatalf("failed to retrieve grace snapshot: %v", err)
+	}
+	if signers := snap.signers(); !reflect.DeepEqual(signers, committee) {
+		t.Errorf("grace signers mismatch: have %v, want %v", signers, committee)
+	}
+	// The third epoch is beyond the grace period, so it must fail
+	if _, err := chain.InsertChain(chain.generate(3, chain.inturn, nil)); err == nil {
+		t.Errorf("epoch beyond the grace period accepted")
+	}
+	if head := chain.CurrentHeader().Number.Uint64(); head >= 10 {
+		t.Errorf("chain advanced beyond the grace period: head #%d", head)
+	}
+	// Without a grace period, the first failure must stall the chain
+	chain = newTesterChain(t, &params.AtmosConfig{Period: 1, Epoch: 3}, []string{"A", "B", "C"}, 0)
+	defer chain.Stop()
+
+	chain.engine.SetComposerSource(NewFakeComposerSource(map[uint64][]common.Address{3: chain.addresses()}))
+	chain.extend(t, 4)
+
+	if _, err := chain.InsertChain(chain.generate(3, chain.inturn, nil)); err == nil {
+		t.Errorf("failed governance lookup tolerated without grace period")
+	}
+}
+
+// Tests that the grace period survives restarts, and that the signers carried over
+// are the committee recorded by the chain, not whatever the node loaded last.
+func TestGovernanceGracePeriodPersisted(t *testing.T) {
+	config := &params.AtmosConfig{Period: 1, Epoch: 3, GovernanceGracePeriodEpochs: 1}
+
+	chain := newTesterChain(t, config, []string{"A", "B", "C"}, 0)
+	defer chain.Stop()
+
+	committee := chain.addresses()
+	chain.engine.SetComposerSource(NewFakeComposerSource(map[uint64][]common.Address{3: committee}))
+	chain.extend(t, 4)
+
+	blocks := chain.generate(3, chain.inturn, nil)
+	headers := make([]*types.Header, len(blocks))
+	for i, block := range blocks {
+		headers[i] = block.Header()
+	}
+	// Restart the engine on the same database with governance down
+	engine := New(chain.engine.config, chain.db)
+	engine.SetComposerSource(NewFakeComposerSource(nil))
+
+	if epoch, signers, err := loadLastSigners(chain.db); err != nil || epoch != 1 || !reflect.DeepEqual(signers, committee) {
+		t.Fatalf("persisted signers mismatch: have %x at epoch %d (%v), want %x at epoch 1", signers, epoch, err, committee)
+	}
+	// A different set seen for the same epoch (e.g. on a side fork) must not leak in
+	engine.trackSigners(1, []common.Address{{0x01}, {0x02}})
+
+	snap, err := engine.snapshot(chain, 6, headers[1].Hash(), headers[:2])
+	if err != nil {
+		t.Fatalf("failed to retrieve grace snapshot after restart: %v", err)
+	}
+	if signers := snap.signers(); !reflect.DeepEqual(signers, committee) {
+		t.Errorf("grace signers mismatch: have %x, want %x", signers, committee)
+	}
+	// Without the persisted signers, the failure must not be tolerated
+	timestamp, err := getComposersCheckTimestamp(engine.config, chain, 6, headers[:2])
+	if err != nil {
+		t.Fatalf("failed to derive the lookup time: %v", err)
+	}
+	if err := chain.db.Delete(composersDBKey(composersKey{epoch: 2, timestamp: timestamp.Int64()})); err != nil {
+		t.Fatalf("failed to delete persisted grace signers: %v", err)
+	}
+	if err := chain.db.Delete(lastSignersDBKey); err != nil {
+		t.Fatalf("failed to delete persisted signers: %v", err)
+	}
+	engine = New(chain.engine.config, chain.db)
+	engine.SetComposerSource(NewFakeComposerSource(nil))
+
+	if _, err := engine.snapshot(chain, 6, headers[1].Hash(), headers[:2]); err == nil {
+		t.Errorf("governance failure tolerated without persisted signers")
+	}
+}
+
+// Tests that a committee carried over during the grace period is persisted for
+// its epoch, so the imported blocks stay valid after the caches are lost and
+// governance comes back serving a different committee.
+func TestGraceSignersPersisted(t *testing.T) {
+	chain := newTesterChain(t, &params.AtmosConfig{Period: 1, Epoch: 3, GovernanceGracePeriodEpochs: 1}, []string{"A", "B", "C"}, 0)
+	defer chain.Stop()
+
+	committee := chain.addresses()
+	chain.engine.SetComposerSource(NewFakeComposerSource(map[uint64][]common.Address{3: committee}))
+	chain.extend(t, 8)
+
+	// Restart on the same database with governance serving another committee
+	engine := New(chain.engine.config, chain.db)
+	engine.SetComposerSource(NewFakeComposerSource(map[uint64][]common.Address{
+		3: committee,
+		6: {chain.accounts.address("D"), chain.accounts.address("E"), chain.accounts.address("F")},
+	}))
+	for number := uint64(7); number <= 8; number++ {
+		if err := engine.VerifyHeader(chain, chain.GetHeaderByNumber(number), true); err != nil {
+			t.Errorf("block %d: failed to re-verify: %v", number, err)
+		}
+	}
+	header := chain.GetHeaderByNumber(6)
+	snap, err := engine.snapshot(chain, 6, header.Hash(), nil)
+	if err != nil {
+		t.Fatalf("failed to retrieve grace snapshot: %v", err)
+	}
+	if signers := snap.signers(); !reflect.DeepEqual(signers, committee) {
+		t.Errorf("grace signers mismatch: have %x, want %x", signers, committee)
+	}
+}
+
+// Tests that blocks rejected for an unauthorized signer, whether imported or
+// locally sealed, are logged along with the offending address.
+func TestUnauthorizedSignerLogged(t *testing.T) {
+	chain := newTesterChain(t, &params.AtmosConfig{Period: 1, Epoch: 30000}, []string{"A", "B"}, 0)
+	defer chain.Stop()
+
+	var (
+		records []*log.Record
+		lock    sync.Mutex
+	)
+	handler := log.Root().GetHandler()
+	defer log.Root().SetHandler(handler)
+
+	log.Root().SetHandler(log.FuncHandler(func(r *log.Record) error {
+		lock.Lock()
+		defer lock.Unlock()
+
+		if r.Lvl == log.LvlError {
+			records = append(records, r)
+		}
+		return nil
+	}))
+	logged := func(addr common.Address) bool {
+		lock.Lock()
+		defer lock.Unlock()
+
+		for _, r := range records {
+			if strings.Contains(string(log.LogfmtFormat().Format(r)), addr.Hex()) {
+				return true
+			}
+		}
+		return false
+	}
+	// Importing a block sealed by an outsider must log the outsider
+	outsider := chain.accounts.address("X")
+	blocks := chain.generate(1, func(uint64) string { return "X" }, nil)
+	if _, err := chain.InsertChain(blocks); verifyCause(err) != errUnauthorizedSigner {
+		t.Fatalf("import error mismatch: have %v, want %v", err, errUnauthorizedSigner)
+	}
+	if !logged(outsider) {
+		t.Errorf("unauthorized import signer %x not logged", outsider)
+	}
+	// Sealing a block with an unauthorized local key must log the local signer
+	local := chain.accounts.address("local")
+	chain.engine.Authorize(local, nil)
+
+	header := &types.Header{
+		ParentHash: chain.genesis.Hash(),
+		Number:     big.NewInt(1),
+		Difficulty: diffNoTurn,
+		Time:       chain.genesis.Time() + 1,
+		Extra:      make([]byte, extraVanity+extraSeal),
+	}
+	if err := chain.engine.Seal(chain, types.NewBlockWithHeader(header), make(chan *types.Block, 1), nil); err != errUnauthorizedSigner {
+		t.Fatalf("seal error mismatch: have %v, want %v", err, errUnauthorizedSigner)
+	}
+	if !logged(local) {
+		t.Errorf("unauthorized local signer %x not logged", local)
+	}
+}
+
+// Tests that imported blocks reward the signer recovered from the seal, whereas
+// locally assembled blocks reward the local signer.
+func TestRewardAttribution(t *testing.T) {
+	chain := newTesterChain(t, &params.AtmosConfig{Period: 1, Epoch: 30000, BlockReward: big.NewInt(1)}, []string{"A", "B"}, 0)
+	defer chain.Stop()
+
+	local, remote := chain.accounts.address("local"), chain.accounts.address(chain.inturn(1))
+	chain.engine.Authorize(local, nil)
+
+	newState := func() *state.StateDB {
+		statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()))
+		return statedb
+	}
+	newHeader := func() *types.Header {
+		header := &types.Header{
+			ParentHash: chain.genesis.Hash(),
+			Number:     big.NewInt(1),
+			Difficulty: diffInTurn,
+			Time:       chain.genesis.Time() + 1,
+			Extra:      make([]byte, extraVanity+extraSeal),
+		}
+		chain.accounts.sign(header, chain.inturn(1))
+		return header
+	}
+	// Importing a remotely sealed block must credit the remote signer
+	statedb := newState()
+	chain.engine.Finalize(chain, newHeader(), statedb, nil, nil)
+	if have := statedb.GetBalance(remote); have.Int64() != 1 {
+		t.Errorf("remote signer balance mismatch on import: have %v, want %d", have, 1)
+	}
+	if have := statedb.GetBalance(local); have.Sign() != 0 {
+		t.Errorf("local signer credited on import: have %v", have)
+	}
+	// Importing a block with a corrupted seal must not credit anyone
+	header := newHeader()
+	for i := len(header.Extra) - extraSeal; i < len(header.Extra); i++ {
+		header.Extra[i] = 0xff
+	}
+	statedb = newState()
+	chain.engine.Finalize(chain, header, statedb, nil, nil)
+	if have := statedb.GetBalance(remote); have.Sign() != 0 {
+		t.Errorf("remote signer credited for corrupted seal: have %v", have)
+	}
+	if have := statedb.GetBalance(local); have.Sign() != 0 {
+		t.Errorf("local signer credited for corrupted seal: have %v", have)
+	}
+	// Assembling a block must credit the local signer, even if it carries a seal
+	statedb = newState()
+	if _, err := chain.engine.FinalizeAndAssemble(chain, newHeader(), statedb, nil, nil, nil); err != nil {
+		t.Fatalf("failed to assemble block: %v", err)
+	}
+	if have := statedb.GetBalance(local); have.Int64() != 1 {
+		t.Errorf("local signer balance mismatch on assembly: have %v, want %d", have, 1)
+	}
+	if have := statedb.GetBalance(remote); have.Sign() != 0 {
+		t.Errorf("remote signer credited on assembly: have %v", have)
+	}
+}
+
+// Tests that a snapshot failure while preparing a block is surfaced as an error
+// instead of producing a header with a nil difficulty.
+func TestPrepareSnapshotFailure(t *testing.T) {
+	// Block 3 is an epoch block, requiring an unreachable governance for its snapshot
+	chain := newTesterChain(t, &params.AtmosConfig{Period: 1, Epoch: 3}, []string{"A", "B"}, 3)
+	defer chain.Stop()
+
+	parent := chain.CurrentHeader()
+	header := &types.Header{ParentHash: parent.Hash(), Number: big.NewInt(4)}
+	if err := chain.engine.Prepare(chain, header); err == nil {
+		t.Fatalf("prepared header without a snapshot")
+	}
+	if header.Difficulty != nil {
+		t.Errorf("difficulty set despite failure: %v", header.Difficulty)
+	}
+	// The engine interface can't error, but must still return a usable difficulty
+	if diff := chain.engine.CalcDifficulty(chain, parent.Time+1, parent); diff == nil || diff.Cmp(diffNoTurn) != 0 {
+		t.Errorf("fallback difficulty mismatch: have %v, want %v", diff, diffNoTurn)
+	}
+}
+
+// Tests that custom turn difficulties are used when sealing and verifying blocks,
+// and that invalid ones fall back to the defaults.
+func TestTurnDifficulties(t *testing.T) {
+	chain := newTesterChain(t, &params.AtmosConfig{Period: 1, Epoch: 30000, InTurnDifficulty: 10, OutOfTurnDifficulty: 1}, []string{"A", "B", "C"}, 2)
+	defer chain.Stop()
+
+	for number := uint64(1); number <= 2; number++ {
+		if have := chain.GetHeaderByNumber(number).Difficulty; have.Int64() != 10 {
+			t.Errorf("block %d difficulty mismatch: have %v, want %d", number, have, 10)
+		}
+	}
+	parent := chain.CurrentHeader()
+	if have := chain.engine.CalcDifficulty(chain, parent.Time+1, parent); have.Int64() != 1 {
+		t.Errorf("out-of-turn difficulty mismatch: have %v, want %d", have, 1)
+	}
+	// An out-of-turn block with the custom difficulty must pass verification
+	blocks := chain.generate(1, func(uint64) string { return chain.inturn(1) }, nil)
+	if have := blocks[0].Difficulty(); have.Int64() != 1 {
+		t.Errorf("out-of-turn block difficulty mismatch: have %v, want %d", have, 1)
+	}
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to import out-of-turn block: %v", err)
+	}
+	// Blocks carrying the default difficulties must be rejected
+	blocks = chain.generate(1, chain.inturn, func(header *types.Header) {
+		header.Difficulty = new(big.Int).Set(diffInTurn)
+	})
+	if _, err := chain.InsertChain(blocks); verifyCause(err) != errInvalidDifficulty {
+		t.Errorf("default difficulty error mismatch: have %v, want %v", err, errInvalidDifficulty)
+	}
+	// Difficulties not favouring in-turn signers must be replaced by the defaults
+	for i, config := range []*params.AtmosConfig{
+		{InTurnDifficulty: 1, OutOfTurnDifficulty: 10},
+		{InTurnDifficulty: 5, OutOfTurnDifficulty: 5},
+		{InTurnDifficulty: 1},
+	} {
+		engine := New(config, nil)
+		if have := turnDifficulty(engine.config, true); have.Cmp(diffInTurn) != 0 {
+			t.Errorf("test %d: in-turn difficulty mismatch: have %v, want %v", i, have, diffInTurn)
+		}
+		if have := turnDifficulty(engine.config, false); have.Cmp(diffNoTurn) != 0 {
+			t.Errorf("test %d: out-of-turn difficulty mismatch: have %v, want %v", i, have, diffNoTurn)
+		}
+	}
+}
+
+// Tests that headers with an extra-data section too short to hold a seal are
+// rejected with an error, never crashing the verifier.
+func TestShortExtraData(t *testing.T) {
+	chain := newTesterChain(t, &params.AtmosConfig{Period: 1, Epoch: 30000}, []string{"A", "B"}, 0)
+	defer chain.Stop()
+
+	for length := 0; length < extraSeal; length++ {
+		header := &types.Header{
+			ParentHash: chain.genesis.Hash(),
+			Number:     big.NewInt(1),
+			Difficulty: diffInTurn,
+			Time:       chain.genesis.Time() + 1,
+			UncleHash:  uncleHash,
+			Extra:      make([]byte, length),
+		}
+		if _, err := sealHash(header); err != errMissingSignature {
+			t.Errorf("extra length %d: seal hash error mismatch: have %v, want %v", length, err, errMissingSignature)
+		}
+		if _, err := chain.engine.Author(header); err != errMissingSignature {
+			t.Errorf("extra length %d: author error mismatch: have %v, want %v", length, err, errMissingSignature)
+		}
+		want := errMissingSignature
+		if length < extraVanity {
+			want = errMissingVanity
+		}
+		if err := chain.engine.VerifyHeader(chain, header, true); verifyCause(err) != want {
+			t.Errorf("extra length %d: verification error mismatch: have %v, want %v", length, err, want)
+		}
+		_, results := chain.engine.VerifyHeaders(chain, []*types.Header{header}, []bool{true})
+		if err := <-results; verifyCause(err) != want {
+			t.Errorf("extra length %d: batch verification error mismatch: have %v, want %v", length, err, want)
+		}
+	}
+}
+
+// Tests that governance signers are persisted to disk on first retrieval, and
+// that subsequent lookups after losing the in-memory cache don't hit the network.
+func TestLoadComposersPersisted(t *testing.T) {
+	addresses, stakes := testComposers(25)
+	gov := newTestGovernance(t, addresses, stakes)
+	defer gov.Close()
+
+	db := rawdb.NewMemoryDatabase()
+	config := &params.AtmosConfig{Epoch: 100, EthereumApiEndpoint: gov.URL}
+
+	first, err := New(config, db).epochSigners(context.Background(), nil, 0, nil)
+	if err != nil {
+		t.Fatalf("failed to load composers: %v", err)
+	}
+	stored, err := loadComposers(db, composersKey{epoch: 0, timestamp: 0})
+	if err != nil {
+		t.Fatalf("failed to load persisted composers: %v", err)
+	}
+	if len(stored) != len(first) {
+		t.Fatalf("persisted signer count mismatch: have %d, want %d", len(stored), len(first))
+	}
+	// Simulate a restart, dropping all in-memory caches
+	second, err := New(config, db).epochSigners(context.Background(), nil, 0, nil)
+	if err != nil {
+		t.Fatalf("failed to reload composers: %v", err)
+	}
+	if calls := gov.Calls(); calls != 1 {
+		t.Fatalf("governance call count mismatch: have %d, want 1", calls)
+	}
+	for i := range first {
+		if first[i] != second[i] || first[i] != stored[i] {
+			t.Fatalf("signer %d mismatch: have %x / %x, want %x", i, second[i], stored[i], first[i])
+		}
+	}
+	// Different epochs and check timestamps must not collide
+	if _, err := loadComposers(db, composersKey{epoch: 1, timestamp: 0}); err == nil {
+		t.Errorf("composers found for unknown epoch")
+	}
+	if _, err := loadComposers(db, composersKey{epoch: 0, timestamp: 1}); err == nil {
+		t.Errorf("composers found for unknown check timestamp")
+	}
+}
+
+// Tests that the random delay of out-of-turn signers scales with the configured
+// wiggle time, whilst in-turn signers are never delayed.
+func TestSealDelayWiggle(t *testing.T) {
+	for _, wiggle := range []time.Duration{10 * time.Millisecond, time.Second, 10 * time.Second} {
+		engine := New(&params.AtmosConfig{WiggleTime: wiggle}, nil)
+
+		// Four signers allow for a wiggle of up to three wiggle times
+		snap := newSnapshot(engine.config, nil, 0, common.Hash{}, []common.Address{{0x1}, {0x2}, {0x3}, {0x4}})
+		bound := 3 * wiggle
+
+		header := &types.Header{Time: uint64(time.Now().Add(time.Hour).Unix())}
+		base := time.Until(time.Unix(int64(header.Time), 0))
+
+		var longest time.Duration
+		for i := 0; i < 1000; i++ {
+			header.Difficulty = diffNoTurn
+			delay := engine.sealDelay(snap, header, false) - base
+			if delay < -time.Second || delay >= bound {
+				t.Fatalf("wiggle %v: out-of-turn delay out of bounds: have %v, want [0, %v)", wiggle, delay, bound)
+			}
+			if delay > longest {
+				longest = delay
+			}
+			header.Difficulty = diffInTurn
+			if delay := engine.sealDelay(snap, header, false) - base; delay > time.Second {
+				t.Fatalf("wiggle %v: in-turn signer delayed by %v", wiggle, delay)
+			}
+		}
+		if longest < bound/2 {
+			t.Errorf("wiggle %v: out-of-turn delay never approached bound: have %v, want ~%v", wiggle, longest, bound)
+		}
+	}
+}
+
+// Tests that with a fixed random source the seal wiggle of out-of-turn signers is
+// reproducible, and that SealForTesting reports the delay Seal would wait for.
+func TestSealForTestingDeterministic(t *testing.T) {
+	const seed = 42
+
+	chain := newTesterChain(t, &params.AtmosConfig{Period: 1, Epoch: 30000, WiggleTime: time.Second}, []string{"A", "B", "C"}, 2)
+	defer chain.Stop()
+	chain.engine.randSource = rand.NewSource(seed)
+
+	// Three signers allow for a wiggle of up to two wiggle times
+	want := time.Duration(rand.New(rand.NewSource(seed)).Int63n(int64(2 * time.Second)))
+
+	signer := chain.inturn(4)
+	chain.engine.Authorize(chain.accounts.address(signer), chain.accounts.signFn(signer))
+
+	parent := chain.CurrentHeader()
+	header := &types.Header{ParentHash: parent.Hash(), Number: big.NewInt(3)}
+	if err := chain.engine.Prepare(chain, header); err != nil {
+		t.Fatalf("failed to prepare header: %v", err)
+	}
+	sealed, delay, err := chain.engine.SealForTesting(chain, types.NewBlockWithHeader(header))
+	if err != nil {
+		t.Fatalf("failed to seal block: %v", err)
+	}
+	if sealed == nil {
+		t.Fatalf("out-of-turn signer refused to seal")
+	}
+	if err := chain.engine.VerifySeal(chain, sealed.Header()); err != nil {
+		t.Errorf("sealed block failed verification: %v", err)
+	}
+	base := time.Until(time.Unix(int64(header.Time), 0))
+	if wiggle := delay - base; wiggle < want-time.Second || wiggle > want+time.Second {
+		t.Errorf("seal delay wiggle mismatch: have %v, want ~%v", wiggle, want)
+	}
+	// The random part of the delay must match exactly on a freshly seeded source
+	chain.engine.randSource = rand.NewSource(seed)
+	snap, err := chain.engine.snapshot(chain, parent.Number.Uint64(), parent.Hash(), nil)
+	if err != nil {
+		t.Fatalf("failed to retrieve snapshot: %v", err)
+	}
+	if have := chain.engine.sealWiggle(snap, sealed.Header(), false); have != want {
+		t.Errorf("seal wiggle mismatch: have %v, want %v", have, want)
+	}
+}
+
+// Tests that zero-period chains pause sealing empty blocks by default, but keep
+// sealing them after a minimum delay if empty blocks are allowed.
+func TestAllowEmptyBlocks(t *testing.T) {
+	for _, allow := range []bool{false, true} {
+		chain := newTesterChain(t, &params.AtmosConfig{Epoch: 30000, DevMode: true, AllowEmptyBlocks: allow}, []string{"A", "B"}, 0)
+		defer chain.Stop()
+
+		signer := chain.inturn(1)
+		chain.engine.Authorize(chain.accounts.address(signer), chain.accounts.signFn(signer))
+
+		parent := chain.CurrentHeader()
+		header := &types.Header{ParentHash: parent.Hash(), Number: big.NewInt(1)}
+		if err := chain.engine.Prepare(chain, header); err != nil {
+			t.Fatalf("allow %v: failed to prepare header: %v", allow, err)
+		}
+		if !allow {
+			if sealed, _, err := chain.engine.SealForTesting(chain, types.NewBlockWithHeader(header)); sealed != nil || err != nil {
+				t.Errorf("empty block sealed with sealing paused: block %v, err %v", sealed != nil, err)
+			}
+			continue
+		}
+		results, stop := make(chan *types.Block, 1), make(chan struct{})
+		defer close(stop)
+
+		start := time.Now()
+		if err := chain.engine.Seal(chain, types.NewBlockWithHeader(header), results, stop); err != nil {
+			t.Fatalf("failed to seal block: %v", err)
+		}
+		select {
+		case block := <-results:
+			if elapsed := time.Since(start); elapsed < emptyBlockDelay {
+				t.Errorf("empty block released too early: have %v, want >= %v", elapsed, emptyBlockDelay)
+			}
+			if err := chain.engine.VerifySeal(chain, block.Header()); err != nil {
+				t.Errorf("sealed empty block failed verification: %v", err)
+			}
+		case <-time.After(emptyBlockDelay + 5*time.Second):
+			t.Errorf("empty block never sealed")
+		}
+	}
+}
+
+// Tests that disabling the wiggle releases out-of-turn and recent blocks as soon as
+// their block time is reached, without any random delay.
+func TestSealDelayNoWiggle(t *testing.T) {
+	engine := New(&params.AtmosConfig{Period: 1, NoWiggle: true, WiggleTime: time.Hour}, nil)
+	snap := newSnapshot(engine.config, nil, 0, common.Hash{}, []common.Address{{0x1}})
+
+	header := &types.Header{Time: uint64(time.Now().Add(time.Hour).Unix()), Difficulty: diffNoTurn}
+	for i := 0; i < 100; i++ {
+		for _, recent := range []bool{false, true} {
+			base := time.Until(time.Unix(int64(header.Time), 0))
+			if delay := engine.sealDelay(snap, header, recent) - base; delay < -time.Second || delay > time.Second {
+				t.Fatalf("recent %v: delay has a random component: %v", recent, delay)
+			}
+		}
+	}
+}
+
+// Tests that the signer committee rotation hook fires exactly once when an epoch
+// snapshot is built with a different signer set than the previous epoch's.
+func TestSignersChangedHook(t *testing.T) {
+	accounts := newTesterAccountPool()
+	labels := accounts.sorted([]string{"A", "B", "C"})
+
+	// Governance drops the last genesis signer from the next committee
+	composers := []common.Address{accounts.address(labels[0]), accounts.address(labels[1])}
+	gov := newTestGovernance(t, composers, []*big.Int{big.NewInt(1e18), big.NewInt(1e18)})
+	defer gov.Close()
+
+	chain := newTesterChainWithAccounts(t, &params.AtmosConfig{Period: 1, Epoch: 3, EthereumApiEndpoint: gov.URL}, accounts, labels, 0)
+	defer chain.Stop()
+
+	type rotation struct {
+		number   uint64
+		old, new []common.Address
+	}
+	var rotations []rotation
+	chain.engine.OnSignersChanged(func(number uint64, old, new []common.Address) {
+		rotations = append(rotations, rotation{number, old, new})
+	})
+	chain.extend(t, 3)
+
+	// Build the epoch snapshot twice, the second one being served from cache
+	head := chain.CurrentHeader()
+	for i := 0; i < 2; i++ {
+		if _, err := chain.engine.snapshot(chain, head.Number.Uint64(), head.Hash(), nil); err != nil {
+			t.Fatalf("failed to retrieve epoch snapshot: %v", err)
+		}
+	}
+	if len(rotations) != 1 {
+		t.Fatalf("rotation count mismatch: have %d, want 1", len(rotations))
+	}
+	if rotations[0].number != 3 {
+		t.Errorf("rotation number mismatch: have %d, want 3", rotations[0].number)
+	}
+	if !reflect.DeepEqual(rotations[0].old, chain.addresses()) {
+		t.Errorf("previous signers mismatch: have %x, want %x", rotations[0].old, chain.addresses())
+	}
+	if !reflect.DeepEqual(rotations[0].new, composers) {
+		t.Errorf("new signers mismatch: have %x, want %x", rotations[0].new, composers)
+	}
+}
+
+// Tests that checkpoint blocks and governance results carrying fewer signers
+// than the configured minimum are rejected.
+func TestMinimumSigners(t *testing.T) {
+	// A checkpoint header encoding a single signer must be rejected on import
+	chain := newTesterChain(t, &params.AtmosConfig{Period: 1, Epoch: 3, StrictRulesBlock: common.Big0}, []string{"A", "B", "C"}, 2)
+	defer chain.Stop()
+
+	blocks := chain.generate(1, chain.inturn, func(header *types.Header) {
+		header.Extra = make([]byte, extraVanity+common.AddressLength+extraSeal)
+		copy(header.Extra[extraVanity:], chain.accounts.address(chain.signers[0]).Bytes())
+	})
+	if _, err := chain.InsertChain(blocks); verifyCause(err) != errInvalidNumberOfSigners {
+		t.Errorf("single signer checkpoint: error mismatch: have %v, want %v", err, errInvalidNumberOfSigners)
+	}
+	// A genesis checkpoint encoding a single signer must not yield a snapshot
+	single := newTesterChain(t, &params.AtmosConfig{Period: 1, Epoch: 3, StrictRulesBlock: common.Big0}, []string{"A"}, 0)
+	defer single.Stop()
+
+	if _, err := single.engine.snapshot(single, 0, single.genesis.Hash(), nil); err != errInvalidNumberOfSigners {
+		t.Errorf("single signer genesis: error mismatch: have %v, want %v", err, errInvalidNumberOfSigners)
+	}
+	// A governance contract returning a single composer must not yield a snapshot
+	accounts := newTesterAccountPool()
+	labels := accounts.sorted([]string{"A", "B", "C"})
+
+	gov := newTestGovernance(t, []common.Address{accounts.address(labels[0])}, []*big.Int{big.NewInt(1e18)})
+	defer gov.Close()
+
+	governed := newTesterChainWithAccounts(t, &params.AtmosConfig{Period: 1, Epoch: 3, EthereumApiEndpoint: gov.URL, StrictRulesBlock: common.Big0}, accounts, labels, 3)
+	defer governed.Stop()
+
+	head := governed.CurrentHeader()
+	if _, err := governed.engine.snapshot(governed, head.Number.Uint64(), head.Hash(), nil); err != errInvalidNumberOfSigners {
+		t.Errorf("single signer governance: error mismatch: have %v, want %v", err, errInvalidNumberOfSigners)
+	}
+}
+
+// Tests that the verbose header verification reports every violation instead of
+// bailing out at the first one.
+func TestVerifyHeaderVerbose(t *testing.T) {
+	chain := newTesterChain(t, &params.AtmosConfig{Period: 1, Epoch: 30000}, []string{"A", "B", "C"}, 3)
+	defer chain.Stop()
+
+	// A valid header must not report any problems
+	valid := chain.generate(1, chain.inturn, nil)[0].Header()
+	if errs := chain.engine.VerifyHeaderVerbose(chain, valid); len(errs) != 0 {
+		t.Fatalf("valid header reported errors: %v", errs)
+	}
+	// A header future-dated, with a mix digest and a bad difficulty reports all three
+	invalid := chain.generate(1, chain.inturn, func(header *types.Header) {
+		header.Time = uint64(time.Now().Add(time.Hour).Unix())
+		header.MixDigest = common.Hash{0x01}
+		header.Difficulty = big.NewInt(5)
+	})[0].Header()
+
+	errs := chain.engine.VerifyHeaderVerbose(chain, invalid)
+	want := []error{consensus.ErrFutureBlock, errInvalidMixDigest, errInvalidDifficulty}
+	if len(errs) != len(want) {
+		t.Fatalf("error count mismatch: have %d (%v), want %d", len(errs), errs, len(want))
+	}
+	for i, err := range want {
+		if errs[i] != err {
+			t.Errorf("error %d mismatch: have %v, want %v", i, errs[i], err)
+		}
+	}
+	// The failing verification must report the first of them
+	if err := chain.engine.VerifyHeader(chain, invalid, false); err != consensus.ErrFutureBlock {
+		t.Errorf("fail-fast error mismatch: have %v, want %v", err, consensus.ErrFutureBlock)
+	}
+}
+
+// Tests that headers from the future are accepted within the configured drift,
+// but rejected beyond it.
+func TestAllowedFutureDrift(t *testing.T) {
+	tests := []struct {
+		drift  time.Duration
+		offset int64
+		err    error
+	}{
+		{0, 0, nil},
+		{0, 2, consensus.ErrFutureBlock},
+		{5 * time.Second, 4, nil},
+		{5 * time.Second, 5, nil},
+		{5 * time.Second, 7, consensus.ErrFutureBlock},
+		{5 * time.Second, 3600, consensus.ErrFutureBlock},
+	}
+	for i, tt := range tests {
+		engine := New(&params.AtmosConfig{AllowedFutureDrift: tt.drift}, nil)
+
+		header := &types.Header{Time: uint64(time.Now().Unix() + tt.offset)}
+		if err := checkFutureBlock(engine, nil, header); err != tt.err {
+			t.Errorf("test %d: error mismatch: have %v, want %v", i, err, tt.err)
+		}
+	}
+}
+
+// Tests that the future block boundary of the header verification follows the
+// engine clock, accepting a header as soon as the clock catches up with it.
+func TestFutureBlockClock(t *testing.T) {
+	chain := newTesterChain(t, &params.AtmosConfig{Period: 1, Epoch: 30000}, []string{"A", "B", "C"}, 2)
+	defer chain.Stop()
+
+	now := int64(1000)
+	chain.engine.clock = func() time.Time { return time.Unix(now, 0) }
+
+	header := chain.generate(1, chain.inturn, func(header *types.Header) {
+		header.Time = 1002
+	})[0].Header()
+
+	for ; now < 1002; now++ {
+		if err := chain.engine.VerifyHeader(chain, header, true); err != consensus.ErrFutureBlock {
+			t.Errorf("clock %d: error mismatch: have %v, want %v", now, err, consensus.ErrFutureBlock)
+		}
+	}
+	if err := chain.engine.VerifyHeader(chain, header, true); err != nil {
+		t.Errorf("clock %d: failed to verify header: %v", now, err)
+	}
+	// Engines created with a clock honour it along with the allowed drift
+	engine := NewWithClock(&params.AtmosConfig{AllowedFutureDrift: 2 * time.Second}, nil, func() time.Time { return time.Unix(1000, 0) })
+	for offset, want := range map[uint64]error{0: nil, 2: nil, 3: consensus.ErrFutureBlock} {
+		if err := checkFutureBlock(engine, nil, &types.Header{Time: 1000 + offset}); err != want {
+			t.Errorf("offset %d: error mismatch: have %v, want %v", offset, err, want)
+		}
+	}
+	if have, want := engine.prepareTime(&types.Header{Number: big.NewInt(1), Time: 10}), uint64(1000); have != want {
+		t.Errorf("prepared timestamp mismatch: have %d, want %d", have, want)
+	}
+}
+
+// Tests that the first blocks of the chain are verified and prepared against the
+// bootstrap period, switching over to the regular period past the ramp.
+func TestBootstrapFastPeriod(t *testing.T) {
+	config := &params.AtmosConfig{Period: 5, Epoch: 30000, BootstrapFastPeriod: 1, BootstrapFastBlocks: 3}
+
+	// Blocks within the ramp may follow each other at the bootstrap period
+	chain := newTesterChain(t, config, []string{"A", "B", "C"}, 0)
+	defer chain.Stop()
+
+	base := uint64(time.Now().Unix()) - 100
+	blocks := chain.generate(4, chain.inturn, func(header *types.Header) {
+		header.Time = base + header.Number.Uint64()
+	})
+	if k, err := chain.InsertChain(blocks[:3]); err != nil {
+		t.Fatalf("failed to import ramp block %d: %v", k, err)
+	}
+	// The first block past the ramp must respect the regular period
+	if _, err := chain.InsertChain(blocks[3:]); verifyCause(err) != ErrInvalidTimestamp {
+		t.Errorf("fast post-ramp block error mismatch: have %v, want %v", err, ErrInvalidTimestamp)
+	}
+	blocks = chain.generate(1, chain.inturn, func(header *types.Header) {
+		header.Time = base + 3 + config.Period
+	})
+	if k, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to import post-ramp block %d: %v", k, err)
+	}
+	// Preparation must agree with verification on the ramp boundary
+	future := uint64(time.Now().Add(time.Hour).Unix())
+	for number, period := range map[uint64]uint64{0: 1, 2: 1, 3: 5, 10: 5} {
+		parent := &types.Header{Number: new(big.Int).SetUint64(number), Time: future}
+		if have, want := chain.engine.prepareTime(parent), future+period; have != want {
+			t.Errorf("parent %d: timestamp mismatch: have %d, want %d", number, have, want)
+		}
+	}
+	// Bootstrap periods slower than the regular one disable the ramp
+	engine := New(&params.AtmosConfig{Period: 5, BootstrapFastPeriod: 10, BootstrapFastBlocks: 3}, nil)
+	if engine.config.BootstrapFastBlocks != 0 {
+		t.Errorf("invalid ramp accepted: %d blocks", engine.config.BootstrapFastBlocks)
+	}
+}
+
+// Tests that Prepare places the configured vanity at the start of the extra-data,
+// leaving the signer list and seal regions untouched.
+func TestPrepareVanity(t *testing.T) {
+	vanity := []byte("aerum/v1.0.0")
+
+	chain := newTesterChain(t, &params.AtmosConfig{Period: 1, Epoch: 3, Vanity: vanity}, []string{"A", "B", "C"}, 2)
+	defer chain.Stop()
+
+	parent := chain.CurrentHeader()
+	extra := bytes.Repeat([]byte{0xff}, extraVanity)
+	header := &types.Header{
+		ParentHash: parent.Hash(),
+		Number:     new(big.Int).Add(parent.Number, common.Big1),
+		Extra:      extra,
+	}
+	if err := chain.engine.Prepare(chain, header); err != nil {
+		t.Fatalf("failed to prepare header: %v", err)
+	}
+	want := make([]byte, extraVanity)
+	copy(want, vanity)
+	if !bytes.Equal(header.Extra[:extraVanity], want) {
+		t.Errorf("vanity mismatch: have %x, want %x", header.Extra[:extraVanity], want)
+	}
+	if !bytes.Equal(extra, bytes.Repeat([]byte{0xff}, extraVanity)) {
+		t.Errorf("caller extra-data modified: %x", extra)
+	}
+	// Block 3 is a checkpoint, the signer list must follow the vanity verbatim
+	signers := chain.addresses()
+	if have, want := len(header.Extra), extraVanity+len(signers)*common.AddressLength+extraSeal; have != want {
+		t.Fatalf("extra-data length mismatch: have %d, want %d", have, want)
+	}
+	for i, signer := range signers {
+		offset := extraVanity + i*common.AddressLength
+		if !bytes.Equal(header.Extra[offset:offset+common.AddressLength], signer[:]) {
+			t.Errorf("signer %d mismatch: have %x, want %x", i, header.Extra[offset:offset+common.AddressLength], signer)
+		}
+	}
+	if seal := header.Extra[len(header.Extra)-extraSeal:]; !bytes.Equal(seal, make([]byte, extraSeal)) {
+		t.Errorf("seal region not empty: %x", seal)
+	}
+	// Overly long vanities are truncated to fit the vanity region
+	engine := New(&params.AtmosConfig{Epoch: 3, Vanity: bytes.Repeat([]byte{0x01}, extraVanity+8)}, rawdb.NewMemoryDatabase())
+	if len(engine.config.Vanity) != extraVanity {
+		t.Errorf("vanity length mismatch: have %d, want %d", len(engine.config.Vanity), extraVanity)
+	}
+}
+
+// Tests that concurrently verified header batches spanning multiple epochs are
+// reported in input order, with failures attributed to the correct headers.
+func TestVerifyHeadersOrdering(t *testing.T) {
+	accounts := newTesterAccountPool()
+	labels := accounts.sorted([]string{"A", "B", "C"})
+
+	composers := make([]common.Address, len(labels))
+	stakes := make([]*big.Int, len(labels))
+	for i, label := range labels {
+		composers[i] = accounts.address(label)
+		stakes[i] = big.NewInt(1e18)
+	}
+	gov := newTestGovernance(t, composers, stakes)
+	defer gov.Close()
+
+	chain := newTesterChainWithAccounts(t, &params.AtmosConfig{Period: 1, Epoch: 3, EthereumApiEndpoint: gov.URL}, accounts, labels, 0)
+	defer chain.Stop()
+
+	// Generate a batch spanning many epochs, corrupting a few scattered headers
+	invalid := map[uint64]bool{2: true, 7: true, 8: true, 16: true, 24: true}
+	blocks := chain.generate(24, chain.inturn, func(header *types.Header) {
+		if invalid[header.Number.Uint64()] {
+			header.MixDigest = common.Hash{0x01}
+		}
+	})
+	headers := make([]*types.Header, len(blocks))
+	for i, block := range blocks {
+		headers[i] = block.Header()
+	}
+	if segments := chain.engine.verifySegments(headers); len(segments) != 8 {
+		t.Fatalf("segment count mismatch: have %d, want %d", len(segments), 8)
+	}
+	abort, results := chain.engine.VerifyHeaders(chain, headers, nil)
+	defer close(abort)
+
+	for i, header := range headers {
+		select {
+		case err := <-results:
+			want := error(nil)
+			if invalid[header.Number.Uint64()] {
+				want = errInvalidMixDigest
+			}
+			if verifyCause(err) != want {
+				t.Errorf("header %d: error mismatch: have %v, want %v", i, err, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("header %d: verification timed out", i)
+		}
+	}
+}
+
+// Tests that the governance lookup timestamp honours the configured lookback and
+// never goes below zero.
+func TestComposersCheckTimestamp(t *testing.T) {
+	chain := newTesterChain(t, &params.AtmosConfig{Period: 1, Epoch: 30000}, []string{"A", "B", "C"}, 3)
+	defer chain.Stop()
+
+	parent := chain.GetHeaderByNumber(2)
+	lookback := func(seconds int64) *int64 { return &seconds }
+	tests := []struct {
+		lookback *int64
+		want     int64
+	}{
+		{lookback: nil, want: 0},                          // default lookback goes negative, clamped
+		{lookback: lookback(-1), want: 0},                 // invalid, default lookback used
+		{lookback: lookback(0), want: int64(parent.Time)}, // no offset
+		{lookback: lookback(5), want: int64(parent.Time) - 5},
+		{lookback: lookback(int64(parent.Time) + 1), want: 0},
+	}
+	for i, tt := range tests {
+		config := New(&params.AtmosConfig{Epoch: 30000, GovernanceLookbackSeconds: tt.lookback}, nil).config
+		timestamp, err := getComposersCheckTimestamp(config, chain, 3, nil)
+		if err != nil {
+			t.Fatalf("test %d: failed to compute timestamp: %v", i, err)
+		}
+		if timestamp.Int64() != tt.want {
+			t.Errorf("test %d: timestamp mismatch: have %d, want %d", i, timestamp.Int64(), tt.want)
+		}
+	}
+}
+
+// Tests that closing the engine tears down governance access, so snapshots not
+// cached yet are rejected instead of dialing Ethereum.
+func TestCloseStopsGovernance(t *testing.T) {
+	accounts := newTesterAccountPool()
+	labels := accounts.sorted([]string{"A", "B", "C"})
+
+	composers := make([]common.Address, len(labels))
+	stakes := make([]*big.Int, len(labels))
+	for i, label := range labels {
+		composers[i] = accounts.address(label)
+		stakes[i] = big.NewInt(1e18)
+	}
+	gov := newTestGovernance(t, composers, stakes)
+	defer gov.Close()
+
+	var dials int32
+	defer func(dial func(context.Context, string) (*ethclient.Client, error)) {
+		dialEthereum = dial
+	}(dialEthereum)
+	dialEthereum = func(ctx context.Context, endpoint string) (*ethclient.Client, error) {
+		atomic.AddInt32(&dials, 1)
+		return ethclient.DialContext(ctx, endpoint)
+	}
+	chain := newTesterChainWithAccounts(t, &params.AtmosConfig{Period: 1, Epoch: 3, EthereumApiEndpoint: gov.URL}, accounts, labels, 5)
+	defer chain.Stop()
+
+	if err := chain.engine.Close(); err != nil {
+		t.Fatalf("failed to close engine: %v", err)
+	}
+	if err := chain.engine.Close(); err != nil {
+		t.Fatalf("failed to close engine twice: %v", err)
+	}
+	if chain.engine.recents.Len() != 0 || chain.engine.signatures.Len() != 0 || chain.engine.composers.Len() != 0 {
+		t.Errorf("caches not purged: recents %d, signatures %d, composers %d", chain.engine.recents.Len(), chain.engine.signatures.Len(), chain.engine.composers.Len())
+	}
+	before := atomic.LoadInt32(&dials)
+
+	head := chain.CurrentHeader()
+	if _, err := chain.engine.snapshot(chain, head.Number.Uint64(), head.Hash(), nil); err != errEngineClosed {
+		t.Errorf("snapshot error mismatch: have %v, want %v", err, errEngineClosed)
+	}
+	if after := atomic.LoadInt32(&dials); after != before {
+		t.Errorf("governance dialed after close: %d new dials", after-before)
+	}
+}
+
+// blockingComposerSource is a composer source blocking every lookup until its
+// context is cancelled, reporting when a lookup starts and how it ended.
+type blockingComposerSource struct {
+	entered chan struct{}
+	exited  chan error
+	once    sync.Once
+}
+
+// Composers implements ComposerSource.
+func (s *blockingComposerSource) Composers(ctx context.Context, number uint64, timestamp *big.Int) ([]common.Address, error) {
+	s.once.Do(func() { close(s.entered) })
+	<-ctx.Done()
+	s.exited <- ctx.Err()
+	return nil, ctx.Err()
+}
+
+// Tests that aborting a batch verification cancels the governance lookups its
+// workers are blocked on, instead of leaving them running.
+func TestVerifyHeadersAbortCancelsGovernance(t *testing.T) {
+	config := &params.AtmosConfig{Period: 1, Epoch: 3, GovernanceCallTimeout: time.Minute}
+
+	chain := newTesterChain(t, config, []string{"A", "B", "C"}, 0)
+	defer chain.Stop()
+	chain.engine.SetComposerSource(NewFakeComposerSource(map[uint64][]common.Address{3: chain.addresses()}))
+
+	blocks := chain.generate(5, chain.inturn, nil)
+	headers := make([]*types.Header, len(blocks))
+	for i, block := range blocks {
+		headers[i] = block.Header()
+	}
+	// Verify the batch with a fresh engine stuck on the epoch lookup
+	source := &blockingComposerSource{entered: make(chan struct{}), exited: make(chan error, 1)}
+	engine := New(chain.engine.config, rawdb.NewMemoryDatabase())
+	engine.SetComposerSource(source)
+
+	abort, _ := engine.VerifyHeaders(chain, headers, make([]bool, len(headers)))
+	select {
+	case <-source.entered:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("governance lookup never started")
+	}
+	close(abort)
+
+	select {
+	case err := <-source.exited:
+		if err != context.Canceled {
+			t.Errorf("lookup context error mismatch: have %v, want %v", err, context.Canceled)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("governance lookup not cancelled on abort")
+	}
+}
+
+// Tests that governance reads are rejected if the Ethereum node hasn't synced up
+// to the lookup timestamp yet, instead of returning stale composers.
+func TestGetComposersNodeBehind(t *testing.T) {
+	addresses, stakes := testComposers(25)
+	gov := newTestGovernance(t, addresses, stakes)
+	defer gov.Close()
+
+	config := New(&params.AtmosConfig{EthereumApiEndpoint: gov.URL, GovernanceRetries: -1}, nil).config
+
+	gov.SetHeadTime(999)
+	if _, err := getComposers(context.Background(), config, 0, big.NewInt(1000)); err != errGovernanceNodeBehind {
+		t.Fatalf("stale head error mismatch: have %v, want %v", err, errGovernanceNodeBehind)
+	}
+	if calls := gov.Calls(); calls != 0 {
+		t.Errorf("governance queried behind the head: %d calls", calls)
+	}
+	gov.SetHeadTime(1000)
+	if _, err := getComposers(context.Background(), config, 0, big.NewInt(1000)); err != nil {
+		t.Fatalf("failed to load composers from synced node: %v", err)
+	}
+}
+
+// Tests that governance responses with stakes not lining up with the composers
+// are rejected instead of selecting a misaligned committee.
+func TestGetComposersMismatchedStakes(t *testing.T) {
+	addresses, stakes := testComposers(5)
+	for _, n := range []int{0, 4, 6} {
+		mismatched := append(stakes[:0:0], stakes...)
+		if n > len(stakes) {
+			mismatched = append(mismatched, big.NewInt(1))
+		} else {
+			mismatched = mismatched[:n]
+		}
+		gov := newTestGovernance(t, addresses, mismatched)
+		config := New(&params.AtmosConfig{EthereumApiEndpoint: gov.URL, GovernanceRetries: -1}, nil).config
+
+		if _, _, err := queryComposers(context.Background(), config, 0, big.NewInt(1000)); err != errComposerStakesMismatch {
+			t.Errorf("%d stakes: error mismatch: have %v, want %v", n, err, errComposerStakesMismatch)
+		}
+		gov.Close()
+	}
+}
+
+// Tests that cached seal hashes match freshly computed ones, even for headers
+// differing only in their signature.
+func TestCachedSealHash(t *testing.T) {
+	engine := New(&params.AtmosConfig{Epoch: 30000}, rawdb.NewMemoryDatabase())
+	accounts := newTesterAccountPool()
+
+	header := &types.Header{Number: big.NewInt(1), Extra: make([]byte, extraVanity+extraSeal)}
+	accounts.sign(header, "A")
+	first := engine.SealHash(header)
+
+	resealed := types.CopyHeader(header)
+	accounts.sign(resealed, "B")
+	if second := engine.SealHash(resealed); second != first {
+		t.Errorf("resealed header seal hash mismatch: have %x, want %x", second, first)
+	}
+	if engine.sealHashes.Len() != 2 {
+		t.Errorf("seal hash cache size mismatch: have %d, want %d", engine.sealHashes.Len(), 2)
+	}
+	// Modifying a sealed field must never serve the stale digest
+	modified := types.CopyHeader(header)
+	modified.Time = 1
+	want, _ := sealHash(modified)
+	if have := engine.SealHash(modified); have != want || have == first {
+		t.Errorf("modified header seal hash mismatch: have %x, want %x", have, want)
+	}
+}
+
+// Benchmarks signer recovery over a batch of headers with and without the seal
+// hash cache, bypassing the signer cache to force the recovery each time.
+func BenchmarkEcrecoverSealHash(b *testing.B) {
+	accounts := newTesterAccountPool()
+	headers := make([]*types.Header, 1000)
+	for i := range headers {
+		headers[i] = &types.Header{Number: big.NewInt(int64(i + 1)), Extra: make([]byte, extraVanity+extraSeal)}
+		accounts.sign(headers[i], "A")
+	}
+	bench := func(b *testing.B, sealcache *lru.ARCCache) {
+		for n := 0; n < b.N; n++ {
+			sigcache, _ := lru.NewARC(inmemorySignatures)
+			for _, header := range headers {
+				if _, err := ecrecover(header, sigcache, sealcache); err != nil {
+					b.Fatalf("failed to recover signer: %v", err)
+				}
+			}
+		}
+	}
+	b.Run("uncached", func(b *testing.B) { bench(b, nil) })
+	b.Run("cached", func(b *testing.B) {
+		sealcache, _ := lru.NewARC(inmemorySealHashes)
+		for _, header := range headers {
+			cachedSealHash(header, header.Hash(), sealcache)
+		}
+		b.ResetTimer()
+		bench(b, sealcache)
+	})
+}
+
+// Tests that a zero block period is only accepted in dev mode once the strict
+// rules are active, where prepared block timestamps still strictly increase.
+func TestDevModeTimestamps(t *testing.T) {
+	if period := New(&params.AtmosConfig{Epoch: 30000, StrictRulesBlock: common.Big0}, nil).blockPeriod(1); period != params.NewAtmosBlockInterval() {
+		t.Errorf("zero period outside dev mode: have %d, want %d", period, params.NewAtmosBlockInterval())
+	}
+	engine := New(&params.AtmosConfig{Epoch: 30000, DevMode: true, StrictRulesBlock: common.Big0}, nil)
+	if period := engine.blockPeriod(1); period != 0 {
+		t.Fatalf("zero period rejected in dev mode: have %d", period)
+	}
+	// Parents from the future must still be strictly followed
+	future := uint64(time.Now().Add(time.Hour).Unix())
+	for i := uint64(0); i < 3; i++ {
+		parent := &types.Header{Number: new(big.Int).SetUint64(i), Time: future + i}
+		if have, want := engine.prepareTime(parent), future+i+1; have != want {
+			t.Errorf("parent %d: timestamp mismatch: have %d, want %d", i, have, want)
+		}
+	}
+	// Consecutively prepared blocks on a live chain must have increasing timestamps
+	chain := newTesterChain(t, &params.AtmosConfig{Epoch: 30000, DevMode: true, StrictRulesBlock: common.Big0}, []string{"A", "B", "C"}, 3)
+	defer chain.Stop()
+
+	parent := chain.CurrentHeader()
+	header := &types.Header{ParentHash: parent.Hash(), Number: new(big.Int).Add(parent.Number, common.Big1)}
+	if err := chain.engine.Prepare(chain, header); err != nil {
+		t.Fatalf("failed to prepare header: %v", err)
+	}
+	if header.Time <= parent.Time {
+		t.Errorf("timestamp not increasing: parent %d, header %d", parent.Time, header.Time)
+	}
+}
+
+// Tests that the governance health check distinguishes a healthy contract, an
+// empty one and an unreachable endpoint, and is skipped with static signers.
+func TestCheckGovernance(t *testing.T) {
+	addresses, stakes := testComposers(3)
+	healthy := newTestGovernance(t, addresses, stakes)
+	defer healthy.Close()
+
+	if err := New(&params.AtmosConfig{EthereumApiEndpoint: healthy.URL}, nil).CheckGovernance(context.Background()); err != nil {
+		t.Errorf("healthy governance rejected: %v", err)
+	}
+	empty := newTestGovernance(t, []common.Address{}, []*big.Int{})
+	defer empty.Close()
+
+	if err := New(&params.AtmosConfig{EthereumApiEndpoint: empty.URL}, nil).CheckGovernance(context.Background()); err != errNoComposers {
+		t.Errorf("empty governance error mismatch: have %v, want %v", err, errNoComposers)
+	}
+	err := New(&params.AtmosConfig{EthereumApiEndpoint: unreachableEndpoint()}, nil).CheckGovernance(context.Background())
+	if err == nil || err == errNoComposers {
+		t.Errorf("unreachable governance error mismatch: have %v", err)
+	}
+	// Static signer chains must start without any governance endpoint
+	if err := New(&params.AtmosConfig{EthereumApiEndpoint: unreachableEndpoint(), StaticSigners: true}, nil).CheckGovernance(context.Background()); err != nil {
+		t.Errorf("static signer chain checked against governance: %v", err)
+	}
+}
+
+// Tests that governance returning composers in reverse order yields a sorted
+// committee, and checkpoints embedding it verify fine.
+func TestReverseSortedComposers(t *testing.T) {
+	accounts := newTesterAccountPool()
+	labels := accounts.sorted([]string{"A", "B", "C", "D", "E"})
+
+	composers := make([]common.Address, len(labels))
+	stakes := make([]*big.Int, len(labels))
+	for i, label := range labels {
+		composers[len(labels)-1-i] = accounts.address(label)
+		stakes[i] = big.NewInt(1e18)
+	}
+	selected := signersProbabilisticSelection(&params.AtmosConfig{SignersPerEpoch: numberOfSigners}, composers, stakes, 3)
+	if !sort.IsSorted(signersAscending(selected)) {
+		t.Errorf("selected signers not sorted: %x", selected)
+	}
+	gov := newTestGovernance(t, composers, stakes)
+	defer gov.Close()
+
+	// Import past two checkpoints, the second one verified against the governance committee
+	chain := newTesterChainWithAccounts(t, &params.AtmosConfig{Period: 1, Epoch: 3, EthereumApiEndpoint: gov.URL}, accounts, labels, 7)
+	defer chain.Stop()
+
+	if head := chain.CurrentHeader().Number.Uint64(); head != 7 {
+		t.Errorf("chain head mismatch: have %d, want %d", head, 7)
+	}
+}
+
+// prunedChain is a chain reader missing all headers up to a given block, as a light
+// client bootstrapped from a checkpoint does.
+type prunedChain struct {
+	consensus.ChainReader
+	pruned uint64
+}
+
+// GetHeader retrieves a header from the wrapped chain, unless it's pruned.
+func (c *prunedChain) GetHeader(hash common.Hash, number uint64) *types.Header {
+	if number <= c.pruned {
+		return nil
+	}
+	return c.ChainReader.GetHeader(hash, number)
+}
+
+// GetHeaderByNumber retrieves a header from the wrapped chain, unless it's pruned.
+func (c *prunedChain) GetHeaderByNumber(number uint64) *types.Header {
+	if number <= c.pruned {
+		return nil
+	}
+	return c.ChainReader.GetHeaderByNumber(number)
+}
+
+// GetHeaderByHash retrieves a header from the wrapped chain, unless it's pruned.
+func (c *prunedChain) GetHeaderByHash(hash common.Hash) *types.Header {
+	if header := c.ChainReader.GetHeaderByHash(hash); header != nil && header.Number.Uint64() > c.pruned {
+		return header
+	}
+	return nil
+}
+
+// Tests that engines bootstrapped with trusted checkpoints verify headers of a
+// chain missing the checkpoint headers without ever querying governance.
+func TestTrustedCheckpoints(t *testing.T) {
+	chain := newTesterChain(t, &params.AtmosConfig{Period: 1, Epoch: 3}, []string{"A", "B", "C"}, 0)
+	defer chain.Stop()
+
+	committee := chain.addresses()
+	chain.engine.SetComposerSource(NewFakeComposerSource(map[uint64][]common.Address{3: committee, 6: committee}))
+	chain.extend(t, 8)
+
+	light := &prunedChain{ChainReader: chain, pruned: 3}
+	headers := make([]*types.Header, 0, 4)
+	for number := uint64(5); number <= 8; number++ {
+		headers = append(headers, chain.GetHeaderByNumber(number))
+	}
+	for i, trusted := range []map[uint64][]common.Address{nil, {1: committee, 2: committee}} {
+		config := *chain.engine.config
+		config.TrustedCheckpoints = trusted
+
+		engine := New(&config, rawdb.NewMemoryDatabase())
+		source := NewFakeComposerSource(nil)
+		engine.SetComposerSource(source)
+
+		abort, results := engine.VerifyHeaders(light, headers, make([]bool, len(headers)))
+		var failed error
+		for range headers {
+			if err := <-results; err != nil && failed == nil {
+				failed = err
+			}
+		}
+		close(abort)
+
+		if trusted == nil {
+			if failed == nil {
+				t.Errorf("test %d: headers verified without checkpoints or governance", i)
+			}
+			if source.Calls() == 0 {
+				t.Errorf("test %d: governance not queried", i)
+			}
+			continue
+		}
+		if failed != nil {
+			t.Errorf("test %d: failed to verify headers: %v", i, failed)
+		}
+		if calls := source.Calls(); calls != 0 {
+			t.Errorf("test %d: governance queried %d times", i, calls)
+		}
+	}
+}
+
+// cancellingChain is a chain reader cancelling a context after serving a given
+// number of header lookups.
+type cancellingChain struct {
+	consensus.ChainReader
+
+	lookups int
+	limit   int
+	cancel  context.CancelFunc
+}
+
+// GetHeader retrieves a header from the wrapped chain, cancelling the context
+// once the lookup limit is reached.
+func (c *cancellingChain) GetHeader(hash common.Hash, number uint64) *types.Header {
+	if c.lookups++; c.lookups == c.limit {
+		c.cancel()
+	}
+	return c.ChainReader.GetHeader(hash, number)
+}
+
+// Tests that cancelling the context aborts a long backward snapshot walk.
+func TestSnapshotCtxCancel(t *testing.T) {
+	chain := newTesterChain(t, &params.AtmosConfig{Period: 1, Epoch: 30000}, []string{"A", "B", "C"}, 200)
+	defer chain.Stop()
+
+	// Drop the cached snapshots to force walking back to genesis
+	chain.engine.recents.Purge()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	reader := &cancellingChain{ChainReader: chain, limit: 50, cancel: cancel}
+	head := chain.CurrentHeader()
+	if _, err := chain.engine.snapshotCtx(ctx, reader, head.Number.Uint64(), head.Hash(), nil); err != context.Canceled {
+		t.Fatalf("error mismatch: have %v, want %v", err, context.Canceled)
+	}
+	if reader.lookups != reader.limit {
+		t.Errorf("walk not aborted promptly: have %d lookups, want %d", reader.lookups, reader.limit)
+	}
+	// The uncancelled walk must still succeed
+	if _, err := chain.engine.snapshot(chain, head.Number.Uint64(), head.Hash(), nil); err != nil {
+		t.Errorf("failed to retrieve snapshot: %v", err)
+	}
+}
+
+// Tests that checkpoints embedding more signers than a committee may hold are
+// rejected upfront, before being compared against the local signer set.
+func TestOversizedCheckpointSigners(t *testing.T) {
+	chain := newTesterChain(t, &params.AtmosConfig{Period: 1, Epoch: 3, StrictRulesBlock: common.Big0}, []string{"A", "B", "C"}, 2)
+	defer chain.Stop()
+
+	for _, count := range []int{numberOfSigners + 1, 10000} {
+		header := chain.generate(1, chain.inturn, func(header *types.Header) {
+			header.Extra = make([]byte, extraVanity+count*common.AddressLength+extraSeal)
+		})[0].Header()
+
+		if err := checkExtraData(chain.engine, chain, header); err != errInvalidCheckpointSigners {
+			t.Errorf("%d signers: standalone error mismatch: have %v, want %v", count, err, errInvalidCheckpointSigners)
+		}
+		if err := chain.engine.VerifyHeader(chain, header, true); verifyCause(err) != errInvalidCheckpointSigners {
+			t.Errorf("%d signers: verification error mismatch: have %v, want %v", count, err, errInvalidCheckpointSigners)
+		}
+	}
+	// A committee of exactly the maximum size is structurally fine
+	header := chain.generate(1, chain.inturn, func(header *types.Header) {
+		header.Extra = make([]byte, extraVanity+numberOfSigners*common.AddressLength+extraSeal)
+	})[0].Header()
+	if err := checkExtraData(chain.engine, chain, header); err != nil {
+		t.Errorf("maximum committee rejected: %v", err)
+	}
+}
+
+// Tests that the stricter checkpoint, period and recents rules only apply from
+// the strict rules block on, leaving the blocks before it valid as they were.
+func TestStrictRulesActivation(t *testing.T) {
+	accounts := newTesterAccountPool()
+	labels := accounts.sorted([]string{"A", "B", "C"})
+
+	// Before the activation, undersized and oversized checkpoints are only
+	// rejected for not matching the local signer set
+	chain := newTesterChainWithAccounts(t, &params.AtmosConfig{Period: 1, Epoch: 3, StrictRulesBlock: big.NewInt(6)}, accounts, labels, 2)
+	defer chain.Stop()
+
+	for _, count := range []int{1, numberOfSigners + 1} {
+		header := chain.generate(1, chain.inturn, func(header *types.Header) {
+			header.Extra = make([]byte, extraVanity+count*common.AddressLength+extraSeal)
+			copy(header.Extra[extraVanity:], chain.accounts.address(chain.signers[0]).Bytes())
+		})[0].Header()
+
+		if err := chain.engine.VerifyHeader(chain, header, true); verifyCause(err) != errMismatchingCheckpointSigners {
+			t.Errorf("%d signers: error mismatch: have %v, want %v", count, err, errMismatchingCheckpointSigners)
+		}
+	}
+	// A non dev mode zero period is only replaced from the activation on
+	engine := New(&params.AtmosConfig{Epoch: 30000, StrictRulesBlock: big.NewInt(10)}, nil)
+	if period := engine.blockPeriod(9); period != 0 {
+		t.Errorf("period before activation mismatch: have %d, want 0", period)
+	}
+	if period := engine.blockPeriod(10); period != params.NewAtmosBlockInterval() {
+		t.Errorf("period after activation mismatch: have %d, want %d", period, params.NewAtmosBlockInterval())
+	}
+	// Governance snapshots are only seeded with recent signers from the activation on
+	governed := newTesterChainWithAccounts(t, &params.AtmosConfig{Period: 1, Epoch: 3, StrictRulesBlock: big.NewInt(6)}, accounts, labels, 0)
+	defer governed.Stop()
+	governed.engine.SetComposerSource(NewFakeComposerSource(map[uint64][]common.Address{3: governed.addresses(), 6: governed.addresses()}))
+	governed.extend(t, 6)
+
+	for _, number := range []uint64{3, 6} {
+		header := governed.GetHeaderByNumber(number)
+		snap, err := governed.engine.snapshot(governed, number, header.Hash(), nil)
+		if err != nil {
+			t.Fatalf("block %d: failed to retrieve snapshot: %v", number, err)
+		}
+		if seeded := len(snap.Recents) > 0; seeded != (number >= 6) {
+			t.Errorf("block %d: recents seeding mismatch: have %v, want %v", number, snap.Recents, number >= 6)
+		}
+	}
+}
+
+// Tests that epoch transitions can be driven by a fake composer source, without
+// reaching out to any network.
+func TestFakeComposerSource(t *testing.T) {
+	chain := newTesterChain(t, &params.AtmosConfig{Period: 1, Epoch: 3}, []string{"A", "B", "C"}, 0)
+	defer chain.Stop()
+
+	committee := chain.addresses()
+	source := NewFakeComposerSource(map[uint64][]common.Address{3: committee, 6: committee, 9: committee})
+	chain.engine.SetComposerSource(source)
+
+	// Import past three epoch transitions, each loading its committee from the source
+	chain.extend(t, 10)
+
+	calls := source.Calls()
+	for _, number := range []uint64{3, 6, 9} {
+		header := chain.GetHeaderByNumber(number)
+		snap, err := chain.engine.snapshot(chain, number, header.Hash(), nil)
+		if err != nil {
+			t.Fatalf("block %d: failed to retrieve snapshot: %v", number, err)
+		}
+		if !reflect.DeepEqual(snap.signers(), committee) {
+			t.Errorf("block %d: signers mismatch: have %x, want %x", number, snap.signers(), committee)
+		}
+	}
+	if source.Calls() != calls {
+		t.Errorf("cached committees reloaded: have %d calls, want %d", source.Calls(), calls)
+	}
+	// A shrunk committee from the source takes effect at the next epoch
+	source.Set(12, committee[:2])
+	chain.extend(t, 2)
+
+	head := chain.CurrentHeader()
+	snap, err := chain.engine.snapshot(chain, head.Number.Uint64(), head.Hash(), nil)
+	if err != nil {
+		t.Fatalf("failed to retrieve shrunk snapshot: %v", err)
+	}
+	if !reflect.DeepEqual(snap.signers(), committee[:2]) {
+		t.Errorf("shrunk signers mismatch: have %x, want %x", snap.signers(), committee[:2])
+	}
+	// Epochs unknown to the source fail the lookup
+	if _, err := source.Composers(context.Background(), 15, big.NewInt(0)); err == nil {
+		t.Errorf("unknown epoch served")
+	}
+}
+
+// Tests that genesis extra-data is laid out as vanity, bytewise sorted signers
+// Tests that the error-returning seal encoders agree with the panicking ones on
+// valid headers, and reject headers too short to contain a signature.
+func TestSealBytes(t *testing.T) {
+	for _, length := range []int{extraSeal, extraVanity + extraSeal, extraVanity + 2*common.AddressLength + extraSeal} {
+		header := &types.Header{
+			Number:     big.NewInt(1),
+			Difficulty: diffInTurn,
+			Extra:      bytes.Repeat([]byte{0x01}, length),
+		}
+		blob, err := SealBytes(header)
+		if err != nil {
+			t.Fatalf("extra length %d: failed to encode seal bytes: %v", length, err)
+		}
+		if want := AtmosRLP(header); !bytes.Equal(blob, want) {
+			t.Errorf("extra length %d: seal bytes mismatch: have %x, want %x", length, blob, want)
+		}
+		hash, err := SealDigest(header)
+		if err != nil {
+			t.Fatalf("extra length %d: failed to hash seal digest: %v", length, err)
+		}
+		if want := SealHash(header); hash != want {
+			t.Errorf("extra length %d: seal digest mismatch: have %x, want %x", length, hash, want)
+		}
+		if want := crypto.Keccak256Hash(blob); hash != want {
+			t.Errorf("extra length %d: seal digest not the hash of the seal bytes: have %x, want %x", length, hash, want)
+		}
+	}
+	for _, length := range []int{0, 1, extraSeal - 1} {
+		header := &types.Header{Number: big.NewInt(1), Extra: make([]byte, length)}
+		if _, err := SealBytes(header); err != errMissingSignature {
+			t.Errorf("extra length %d: seal bytes error mismatch: have %v, want %v", length, err, errMissingSignature)
+		}
+		if _, err := SealDigest(header); err != errMissingSignature {
+			t.Errorf("extra length %d: seal digest error mismatch: have %v, want %v", length, err, errMissingSignature)
+		}
+	}
+}
+
+// Tests that genesis building, governance selection and snapshot construction
+// all reduce the same signers to the same canonical, sorted and deduplicated list.
+func TestSortAndDedupSigners(t *testing.T) {
+	var (
+		a = common.HexToAddress("0x0100000000000000000000000000000000000000")
+		b = common.HexToAddress("0x0100000000000000000000000000000000000001")
+		c = common.HexToAddress("0x02c362540efc9fa5592621c9212d0bf776732050")
+	)
+	canonical := []common.Address{a, b, c}
+
+	for i, signers := range [][]common.Address{
+		{a, b, c},
+		{c, b, a},
+		{c, a, c, b, a, b},
+		{a, a, a, b, c, c},
+	} {
+		original := append([]common.Address{}, signers...)
+
+		if have := sortAndDedupSigners(signers); !reflect.DeepEqual(have, canonical) {
+			t.Errorf("test %d: canonical signers mismatch: have %x, want %x", i, have, canonical)
+		}
+		// The genesis extra-data must embed the canonical list
+		extra := MakeExtraData(signers)
+		if !reflect.DeepEqual(checkpointSigners(&types.Header{Extra: extra}), canonical) {
+			t.Errorf("test %d: extra-data signers mismatch: have %x, want %x", i, checkpointSigners(&types.Header{Extra: extra}), canonical)
+		}
+		// The governance selection must pick the canonical list
+		stakes := make([]*big.Int, len(signers))
+		for j := range stakes {
+			stakes[j] = big.NewInt(1e18)
+		}
+		selected := signersProbabilisticSelection(&params.AtmosConfig{SignersPerEpoch: numberOfSigners}, signers, stakes, 100)
+		if !reflect.DeepEqual(selected, canonical) {
+			t.Errorf("test %d: selected signers mismatch: have %x, want %x", i, selected, canonical)
+		}
+		// The snapshot must report the canonical list
+		snap := newSnapshot(&params.AtmosConfig{}, nil, 0, common.Hash{}, signers)
+		if have := snap.signers(); !reflect.DeepEqual(have, canonical) {
+			t.Errorf("test %d: snapshot signers mismatch: have %x, want %x", i, have, canonical)
+		}
+		if !reflect.DeepEqual(signers, original) {
+			t.Errorf("test %d: input signers modified: have %x, want %x", i, signers, original)
+		}
+	}
+	if have := sortAndDedupSigners(nil); have == nil || len(have) != 0 {
+		t.Errorf("empty signers mismatch: have %v, want []", have)
+	}
+}
+
+// and seal, without reordering the caller's signer list.
+func TestMakeExtraData(t *testing.T) {
+	signers := []common.Address{
+		common.HexToAddress("0x0300000000000000000000000000000000000000"),
+		common.HexToAddress("0x0100000000000000000000000000000000000000"),
+		common.HexToAddress("0x02c362540efc9fa5592621c9212d0bf776732050"),
+		common.HexToAddress("0x0100000000000000000000000000000000000001"),
+	}
+	original := append([]common.Address{}, signers...)
+
+	for n := 0; n <= len(signers); n++ {
+		extra := MakeExtraData(signers[:n])
+		if len(extra) != extraVanity+n*common.AddressLength+extraSeal {
+			t.Fatalf("%d signers: extra-data length mismatch: have %d, want %d", n, len(extra), extraVanity+n*common.AddressLength+extraSeal)
+		}
+		if !bytes.Equal(extra[:extraVanity], make([]byte, extraVanity)) {
+			t.Errorf("%d signers: non-zero vanity: %x", n, extra[:extraVanity])
+		}
+		if !bytes.Equal(extra[len(extra)-extraSeal:], make([]byte, extraSeal)) {
+			t.Errorf("%d signers: non-zero seal: %x", n, extra[len(extra)-extraSeal:])
+		}
+		parsed := make([]common.Address, n)
+		for i := range parsed {
+			copy(parsed[i][:], extra[extraVanity+i*common.AddressLength:])
+		}
+		if !sort.SliceIsSorted(parsed, func(i, j int) bool { return bytes.Compare(parsed[i][:], parsed[j][:]) < 0 }) {
+			t.Errorf("%d signers: signers not sorted: %x", n, parsed)
+		}
+		want := append([]common.Address{}, signers[:n]...)
+		sort.Slice(want, func(i, j int) bool { return bytes.Compare(want[i][:], want[j][:]) < 0 })
+		if !reflect.DeepEqual(parsed, want) {
+			t.Errorf("%d signers: signers mismatch: have %x, want %x", n, parsed, want)
+		}
+	}
+	if !reflect.DeepEqual(signers, original) {
+		t.Errorf("input signers reordered: have %x, want %x", signers, original)
+	}
+}
+
+// Tests that snapshots applied concurrently on top of a shared parent for two
+// diverging branches, and the ones cached for them, don't share any state.
+func TestSnapshotApplyIndependent(t *testing.T) {
+	chain := newTesterChain(t, &params.AtmosConfig{Period: 1, Epoch: 30000}, []string{"A", "B", "C", "D", "E"}, 2)
+	defer chain.Stop()
+
+	head := chain.CurrentHeader()
+	parent, err := chain.engine.snapshot(chain, head.Number.Uint64(), head.Hash(), nil)
+	if err != nil {
+		t.Fatalf("failed to retrieve parent snapshot: %v", err)
+	}
+	recents := make(map[uint64]common.Address)
+	for number, signer := range parent.Recents {
+		recents[number] = signer
+	}
+	// Create two sibling branches sealed by different signers
+	signers := []func(uint64) string{
+		chain.inturn,
+		func(number uint64) string { return chain.inturn(number + 2) },
+	}
+	branches := make([][]*types.Header, len(signers))
+	for i, signer := range signers {
+		for _, block := range chain.generate(3, signer, nil) {
+			branches[i] = append(branches[i], block.Header())
+		}
+	}
+	var (
+		errs = make([]error, len(branches))
+		wg   sync.WaitGroup
+	)
+	for i := range branches {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			tip := branches[i][len(branches[i])-1]
+			_, errs[i] = chain.engine.snapshot(chain, tip.Number.Uint64(), tip.Hash(), branches[i])
+		}(i)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("branch %d: failed to retrieve snapshot: %v", i, err)
+		}
+	}
+	if !reflect.DeepEqual(parent.Recents, recents) {
+		t.Errorf("parent recents mutated: have %v, want %v", parent.Recents, recents)
+	}
+	// Each cached snapshot must only reflect the signers of its own branch
+	for i, branch := range branches {
+		tip := branch[len(branch)-1]
+		cached, ok := chain.engine.recents.Get(tip.Hash())
+		if !ok {
+			t.Fatalf("branch %d: snapshot not cached", i)
+		}
+		want := make(map[uint64]common.Address)
+		for _, header := range branch {
+			number := header.Number.Uint64()
+			want[number] = chain.accounts.address(signers[i](number))
+		}
+		if have := cached.(*Snapshot).Recents; !reflect.DeepEqual(have, want) {
+			t.Errorf("branch %d: cached recents mismatch: have %v, want %v", i, have, want)
+		}
+	}
+}
+
+// Tests that snapshot lookups walking back further than the configured depth,
+// as when no snapshot is cached, are flagged by a single warning.
+func TestSnapshotDeepWalkWarning(t *testing.T) {
+	defer func(counter metrics.Counter) {
+		snapshotDeepWalkCounter = counter
+	}(snapshotDeepWalkCounter)
+	snapshotDeepWalkCounter = metrics.NewCounterForced()
+
+	chain := newTesterChain(t, &params.AtmosConfig{Period: 1, Epoch: 30000, SnapshotWalkWarnDepth: 8}, []string{"A", "B"}, 20)
+	defer chain.Stop()
+
+	var (
+		records []*log.Record
+		lock    sync.Mutex
+	)
+	handler := log.Root().GetHandler()
+	defer log.Root().SetHandler(handler)
+
+	log.Root().SetHandler(log.FuncHandler(func(r *log.Record) error {
+		lock.Lock()
+		defer lock.Unlock()
+
+		if r.Lvl == log.LvlWarn && r.Msg == "Snapshot lookup walked back deep" {
+			records = append(records, r)
+		}
+		return nil
+	}))
+	// Shallow walks must not be flagged
+	head := chain.CurrentHeader()
+	chain.engine.recents.Remove(head.Hash())
+
+	if _, err := chain.engine.snapshot(chain, head.Number.Uint64(), head.Hash(), nil); err != nil {
+		t.Fatalf("failed to retrieve snapshot: %v", err)
+	}
+	if len(records) != 0 {
+		t.Fatalf("shallow walk flagged: %d warnings", len(records))
+	}
+	// Walking back to the genesis must be flagged exactly once
+	chain.engine.recents.Purge()
+	if _, err := chain.engine.snapshot(chain, head.Number.Uint64(), head.Hash(), nil); err != nil {
+		t.Fatalf("failed to retrieve snapshot: %v", err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("warning count mismatch: have %d, want %d", len(records), 1)
+	}
+	if have := snapshotDeepWalkCounter.Count(); have != 1 {
+		t.Errorf("deep walk count mismatch: have %d, want %d", have, 1)
+	}
+	if line := string(log.LogfmtFormat().Format(records[0])); !strings.Contains(line, "from=20") || !strings.Contains(line, "to=0") {
+		t.Errorf("walk bounds not logged: %s", line)
+	}
+}
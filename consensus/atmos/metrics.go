@@ -0,0 +1,38 @@
+// Copyright 2017 The go-aerum Authors
+// This file is part of the go-aerum library.
+//
+// The go-aerum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-aerum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-aerum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Contains the metrics collected by the atmos consensus engine.
+
+package atmos
+
+import (
+	"github.com/AERUMTechnology/go-aerum/metrics"
+)
+
+var (
+	sealInTurnCounter = metrics.NewRegisteredCounter("consensus/atmos/seal/inturn", nil)
+	sealNoTurnCounter = metrics.NewRegisteredCounter("consensus/atmos/seal/noturn", nil)
+
+	governanceComposersTimer = metrics.NewRegisteredTimer("consensus/atmos/governance/composers", nil)
+
+	snapshotHitCounter  = metrics.NewRegisteredCounter("consensus/atmos/snapshot/hit", nil)
+	snapshotMissCounter = metrics.NewRegisteredCounter("consensus/atmos/snapshot/miss", nil)
+
+	snapshotDeepWalkCounter = metrics.NewRegisteredCounter("consensus/atmos/snapshot/deepwalk", nil)
+
+	verifyRecentCounter       = metrics.NewRegisteredCounter("consensus/atmos/verify/recent", nil)
+	verifyUnauthorizedCounter = metrics.NewRegisteredCounter("consensus/atmos/verify/unauthorized", nil)
+)
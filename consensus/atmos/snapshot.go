@@ -18,6 +18,7 @@ package atmos
 
 import (
 	"bytes"
+	"encoding/binary"
 	"encoding/json"
 	"sort"
 	"time"
@@ -48,9 +49,26 @@ func (s signersAscending) Len() int           { return len(s) }
 func (s signersAscending) Less(i, j int) bool { return bytes.Compare(s[i][:], s[j][:]) < 0 }
 func (s signersAscending) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
 
+// Added by Aerum
+// sortAndDedupSigners returns the canonical form of a signer list, sorted in
+// ascending byte order with any duplicates removed. The input is not modified.
+func sortAndDedupSigners(signers []common.Address) []common.Address {
+	sorted := make([]common.Address, len(signers))
+	copy(sorted, signers)
+	sort.Sort(signersAscending(sorted))
+
+	canonical := sorted[:0]
+	for _, signer := range sorted {
+		if len(canonical) == 0 || canonical[len(canonical)-1] != signer {
+			canonical = append(canonical, signer)
+		}
+	}
+	return canonical
+}
+
 // newSnapshot creates a new snapshot with the specified startup parameters. This
 // method does not initialize the set of recent signers, so only ever use if for
-// the genesis block.
+// the genesis block, or seed them afterwards via seedRecents.
 func newSnapshot(config *params.AtmosConfig, sigcache *lru.ARCCache, number uint64, hash common.Hash, signers []common.Address) *Snapshot {
 	snap := &Snapshot{
 		config:   config,
@@ -66,6 +84,29 @@ func newSnapshot(config *params.AtmosConfig, sigcache *lru.ARCCache, number uint
 	return snap
 }
 
+// Added by Aerum
+// seedRecents records the signers of the given headers, in ascending order and
+// ending at the snapshot block, as recent signers the way applying them would
+// have. Headers already shifted out of the recent window are ignored, as are
+// signers not part of the snapshot, since they can't sign anymore anyway.
+func (s *Snapshot) seedRecents(headers []*types.Header) error {
+	limit := uint64(len(s.Signers)/2 + 1)
+	for _, header := range headers {
+		number := header.Number.Uint64()
+		if number > s.Number || number+limit <= s.Number {
+			continue
+		}
+		signer, err := ecrecover(header, s.sigcache, nil)
+		if err != nil {
+			return err
+		}
+		if _, ok := s.Signers[signer]; ok {
+			s.Recents[number] = signer
+		}
+	}
+	return nil
+}
+
 // loadSnapshot loads an existing snapshot from the database.
 func loadSnapshot(config *params.AtmosConfig, sigcache *lru.ARCCache, db ethdb.Database, hash common.Hash) (*Snapshot, error) {
 	blob, err := db.Get(append([]byte("atmos-"), hash[:]...))
@@ -91,7 +132,85 @@ func (s *Snapshot) store(db ethdb.Database) error {
 	return db.Put(append([]byte("atmos-"), s.Hash[:]...), blob)
 }
 
-// copy creates a deep copy of the snapshot, though not the individual votes.
+// Added by Aerum
+// deleteSnapshot removes a snapshot from the database.
+func deleteSnapshot(db ethdb.Database, hash common.Hash) error {
+	return db.Delete(append([]byte("atmos-"), hash[:]...))
+}
+
+// Added by Aerum
+// composersDBKey returns the database key under which the governance signers of
+// a lookup are persisted.
+func composersDBKey(key composersKey) []byte {
+	enc := make([]byte, 16)
+	binary.BigEndian.PutUint64(enc[:8], key.epoch)
+	binary.BigEndian.PutUint64(enc[8:], uint64(key.timestamp))
+	return append([]byte("atmos-composers-"), enc...)
+}
+
+// Added by Aerum
+// loadComposers loads the governance signers of a previous lookup from the database.
+func loadComposers(db ethdb.Database, key composersKey) ([]common.Address, error) {
+	blob, err := db.Get(composersDBKey(key))
+	if err != nil {
+		return nil, err
+	}
+	var signers []common.Address
+	if err := json.Unmarshal(blob, &signers); err != nil {
+		return nil, err
+	}
+	return signers, nil
+}
+
+// Added by Aerum
+// storeComposers inserts the governance signers of a lookup into the database.
+func storeComposers(db ethdb.Database, key composersKey, signers []common.Address) error {
+	blob, err := json.Marshal(signers)
+	if err != nil {
+		return err
+	}
+	return db.Put(composersDBKey(key), blob)
+}
+
+// Added by Aerum
+// lastSignersDBKey is the database key under which the most recent signer set
+// loaded from governance is persisted.
+var lastSignersDBKey = []byte("atmos-composers-last")
+
+// Added by Aerum
+// lastSigners is the most recent signer set loaded from governance, along with
+// the epoch it was loaded for.
+type lastSigners struct {
+	Epoch   uint64           `json:"epoch"`
+	Signers []common.Address `json:"signers"`
+}
+
+// Added by Aerum
+// loadLastSigners loads the most recent governance signer set from the database.
+func loadLastSigners(db ethdb.Database) (uint64, []common.Address, error) {
+	blob, err := db.Get(lastSignersDBKey)
+	if err != nil {
+		return 0, nil, err
+	}
+	var last lastSigners
+	if err := json.Unmarshal(blob, &last); err != nil {
+		return 0, nil, err
+	}
+	return last.Epoch, last.Signers, nil
+}
+
+// Added by Aerum
+// storeLastSigners inserts the most recent governance signer set into the database.
+func storeLastSigners(db ethdb.Database, epoch uint64, signers []common.Address) error {
+	blob, err := json.Marshal(&lastSigners{Epoch: epoch, Signers: signers})
+	if err != nil {
+		return err
+	}
+	return db.Put(lastSignersDBKey, blob)
+}
+
+// copy creates a deep copy of the snapshot, sharing only the engine config and
+// signature cache with the original.
 func (s *Snapshot) copy() *Snapshot {
 	cpy := &Snapshot{
 		config:   s.config,
@@ -112,11 +231,12 @@ func (s *Snapshot) copy() *Snapshot {
 }
 
 // apply creates a new authorization snapshot by applying the given headers to
-// the original one.
+// the original one. The original is never modified and the result never shares
+// state with it, so snapshots cached for sibling branches stay independent.
 func (s *Snapshot) apply(headers []*types.Header) (*Snapshot, error) {
 	// Allow passing in no headers for cleaner code
 	if len(headers) == 0 {
-		return s, nil
+		return s.copy(), nil
 	}
 	// Sanity check that the headers can be applied
 	for i := 0; i < len(headers)-1; i++ {
@@ -142,7 +262,7 @@ func (s *Snapshot) apply(headers []*types.Header) (*Snapshot, error) {
 			delete(snap.Recents, number-limit)
 		}
 		// Resolve the authorization key and check against signers
-		signer, err := ecrecover(header, s.sigcache)
+		signer, err := ecrecover(header, s.sigcache, nil)
 		if err != nil {
 			return nil, err
 		}
@@ -172,8 +292,36 @@ func (s *Snapshot) signers() []common.Address {
 	for sig := range s.Signers {
 		sigs = append(sigs, sig)
 	}
-	sort.Sort(signersAscending(sigs))
-	return sigs
+	return sortAndDedupSigners(sigs)
+}
+
+// recentlySigned returns whether a signer is amongst the recent signers for a
+// block at the given height, and thus would be rejected by the spam protection.
+func (s *Snapshot) recentlySigned(number uint64, signer common.Address) bool {
+	for seen, recent := range s.Recents {
+		if recent == signer {
+			// Signer is among recents, only wait if the current block doesn't shift it out
+			if limit := uint64(len(s.Signers)/2 + 1); number < limit || seen > number-limit {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Added by Aerum
+// validVote returns whether it makes sense to cast the specified vote in the
+// given snapshot context (e.g. don't try to add an already authorized signer).
+func (s *Snapshot) validVote(address common.Address, authorize bool) bool {
+	_, signer := s.Signers[address]
+	return (signer && !authorize) || (!signer && authorize)
+}
+
+// Added by Aerum
+// inturnSigner returns the signer expected to seal the given block height in-turn.
+func (s *Snapshot) inturnSigner(number uint64) common.Address {
+	signers := s.signers()
+	return signers[number%uint64(len(signers))]
 }
 
 // inturn returns if a signer at a given block height is in-turn or not.
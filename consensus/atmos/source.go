@@ -0,0 +1,152 @@
+// Copyright 2017 The go-aerum Authors
+// This file is part of the go-aerum library.
+//
+// The go-aerum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-aerum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-aerum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Contains the sources the atmos consensus engine loads epoch signers from.
+
+package atmos
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sync"
+
+	"github.com/AERUMTechnology/go-aerum/common"
+	"github.com/AERUMTechnology/go-aerum/params"
+)
+
+// ComposerSource provides the signers selected out of the governance composers
+// for an epoch block, as seen at the given lookup timestamp.
+type ComposerSource interface {
+	Composers(ctx context.Context, number uint64, timestamp *big.Int) ([]common.Address, error)
+}
+
+// ComposerLister is implemented by composer sources able to list the full set of
+// composers along with their stakes, before any signers are selected out of them.
+type ComposerLister interface {
+	ListComposers(ctx context.Context, number uint64, timestamp *big.Int) ([]common.Address, []*big.Int, error)
+}
+
+// governanceSource is the default composer source, querying the governance
+// contract through the configured Ethereum endpoints.
+type governanceSource struct {
+	config *params.AtmosConfig
+}
+
+// NewGovernanceSource creates a composer source querying the governance contract
+// deployed at the given address through the given Ethereum endpoint, selecting
+// the signers the same way the engine does.
+func NewGovernanceSource(endpoint string, address common.Address) ComposerSource {
+	return &governanceSource{config: &params.AtmosConfig{
+		EthereumApiEndpoint: endpoint,
+		GovernanceAddress:   address,
+		SignersPerEpoch:     numberOfSigners,
+	}}
+}
+
+// Composers implements ComposerSource, loading the composers from the governance
+// contract and selecting the epoch signers out of them.
+func (s *governanceSource) Composers(ctx context.Context, number uint64, timestamp *big.Int) ([]common.Address, error) {
+	return getComposers(ctx, s.config, number, timestamp)
+}
+
+// ListComposers implements ComposerLister, loading the composers and their stakes
+// from the governance contract.
+func (s *governanceSource) ListComposers(ctx context.Context, number uint64, timestamp *big.Int) ([]common.Address, []*big.Int, error) {
+	return queryComposers(ctx, s.config, number, timestamp)
+}
+
+// FakeComposerSource is a composer source serving preconfigured signers for each
+// epoch block, without reaching out to any network. It is meant for testing.
+type FakeComposerSource struct {
+	signers   map[uint64][]common.Address
+	composers map[uint64]fakeComposers
+	calls     int
+	lock      sync.Mutex
+}
+
+// fakeComposers is a full composer set served by FakeComposerSource.
+type fakeComposers struct {
+	addresses []common.Address
+	stakes    []*big.Int
+}
+
+// NewFakeComposerSource creates a composer source serving the given signers,
+// keyed by epoch block number.
+func NewFakeComposerSource(signers map[uint64][]common.Address) *FakeComposerSource {
+	source := &FakeComposerSource{
+		signers:   make(map[uint64][]common.Address),
+		composers: make(map[uint64]fakeComposers),
+	}
+	for number, set := range signers {
+		source.signers[number] = append([]common.Address(nil), set...)
+	}
+	return source
+}
+
+// Composers implements ComposerSource, returning the signers configured for the
+// epoch block, or an error if none were.
+func (s *FakeComposerSource) Composers(ctx context.Context, number uint64, timestamp *big.Int) ([]common.Address, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.calls++
+	signers, ok := s.signers[number]
+	if !ok {
+		return nil, fmt.Errorf("no fake composers for block %d", number)
+	}
+	return append([]common.Address(nil), signers...), nil
+}
+
+// Set replaces the signers served for an epoch block.
+func (s *FakeComposerSource) Set(number uint64, signers []common.Address) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.signers[number] = append([]common.Address(nil), signers...)
+}
+
+// SetComposers configures the full composer set listed for an epoch block.
+func (s *FakeComposerSource) SetComposers(number uint64, addresses []common.Address, stakes []*big.Int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.composers[number] = fakeComposers{
+		addresses: append([]common.Address(nil), addresses...),
+		stakes:    append([]*big.Int(nil), stakes...),
+	}
+}
+
+// ListComposers implements ComposerLister, returning the full composer set
+// configured for the epoch block, or an error if none was.
+func (s *FakeComposerSource) ListComposers(ctx context.Context, number uint64, timestamp *big.Int) ([]common.Address, []*big.Int, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	composers, ok := s.composers[number]
+	if !ok {
+		return nil, nil, fmt.Errorf("no fake composer list for block %d", number)
+	}
+	return append([]common.Address(nil), composers.addresses...), append([]*big.Int(nil), composers.stakes...), nil
+}
+
+// Calls returns the number of composer lookups served so far.
+func (s *FakeComposerSource) Calls() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.calls
+}
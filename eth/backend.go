@@ -18,6 +18,7 @@
 package eth
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"math/big"
@@ -168,6 +169,17 @@ func New(ctx *node.ServiceContext, config *Config) (*Ethereum, error) {
 		bloomRequests:  make(chan chan *bloombits.Retrieval),
 		bloomIndexer:   NewBloomIndexer(chainDb, params.BloomBitsBlocks, params.BloomConfirms),
 	}
+	// Added by Aerum
+	// Fail fast on invalid network parameter overrides, or if the Atmos governance
+	// contract is unreachable, instead of at the first epoch
+	if engine, ok := eth.engine.(*atmos.Atmos); ok {
+		if err := params.AtmosParamsEnvError(); err != nil {
+			return nil, err
+		}
+		if err := engine.CheckGovernance(context.Background()); err != nil {
+			return nil, err
+		}
+	}
 
 	bcVersion := rawdb.ReadDatabaseVersion(chainDb)
 	var dbVer = "<nil>"
@@ -0,0 +1,71 @@
+// Copyright 2016 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Contains wrappers for the Atmos consensus APIs.
+
+package geth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/AERUMTechnology/go-aerum/common"
+	"github.com/AERUMTechnology/go-aerum/common/hexutil"
+	"github.com/AERUMTechnology/go-aerum/rpc"
+)
+
+// errAtmosUnavailable is returned if the remote node doesn't serve the Atmos
+// consensus APIs, which is the case for light clients.
+var errAtmosUnavailable = errors.New("atmos APIs not available (light clients don't track consensus snapshots)")
+
+// GetAtmosSigners returns the signers authorized to seal at the given block. If
+// number is <0, the signers at the latest known block are returned.
+func (ec *EthereumClient) GetAtmosSigners(ctx *Context, number int64) (signers *Addresses, _ error) {
+	var rawSigners []common.Address
+	if err := ec.callAtmos(ctx, &rawSigners, "atmos_getSigners", number); err != nil {
+		return nil, err
+	}
+	return &Addresses{rawSigners}, nil
+}
+
+// GetAtmosSnapshot returns the JSON encoded Atmos consensus snapshot at the given
+// block. If number is <0, the snapshot at the latest known block is returned.
+func (ec *EthereumClient) GetAtmosSnapshot(ctx *Context, number int64) (snapshot string, _ error) {
+	var rawSnapshot json.RawMessage
+	if err := ec.callAtmos(ctx, &rawSnapshot, "atmos_getSnapshot", number); err != nil {
+		return "", err
+	}
+	if len(rawSnapshot) == 0 || string(rawSnapshot) == "null" {
+		return "", fmt.Errorf("atmos snapshot not available for block %d", number)
+	}
+	return string(rawSnapshot), nil
+}
+
+// callAtmos invokes an Atmos API method on the given block, translating missing
+// APIs into a descriptive error.
+func (ec *EthereumClient) callAtmos(ctx *Context, result interface{}, method string, number int64) error {
+	arg := "latest"
+	if number >= 0 {
+		arg = hexutil.EncodeBig(big.NewInt(number))
+	}
+	err := ec.rpc.CallContext(ctx.context, result, method, arg)
+	if rpcErr, ok := err.(rpc.Error); ok && rpcErr.ErrorCode() == -32601 {
+		return errAtmosUnavailable
+	}
+	return err
+}
@@ -0,0 +1,124 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package geth
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/AERUMTechnology/go-aerum/common"
+	"github.com/AERUMTechnology/go-aerum/ethclient"
+	"github.com/AERUMTechnology/go-aerum/rpc"
+)
+
+// testAtmosAPI mimics the Atmos consensus API, serving fixed signers up to a
+// head block.
+type testAtmosAPI struct {
+	head    rpc.BlockNumber
+	signers []common.Address
+}
+
+func (api *testAtmosAPI) block(number *rpc.BlockNumber) (rpc.BlockNumber, error) {
+	if number == nil || *number == rpc.LatestBlockNumber {
+		return api.head, nil
+	}
+	if *number > api.head {
+		return 0, errors.New("unknown block")
+	}
+	return *number, nil
+}
+
+func (api *testAtmosAPI) GetSigners(number *rpc.BlockNumber) ([]common.Address, error) {
+	if _, err := api.block(number); err != nil {
+		return nil, err
+	}
+	return api.signers, nil
+}
+
+func (api *testAtmosAPI) GetSnapshot(number *rpc.BlockNumber) (map[string]interface{}, error) {
+	block, err := api.block(number)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"number": block, "signers": api.signers}, nil
+}
+
+// newTestAtmosClient creates a mobile client attached to an in-process server
+// exposing the given Atmos API, or none at all if nil.
+func newTestAtmosClient(t *testing.T, api *testAtmosAPI) *EthereumClient {
+	server := rpc.NewServer()
+	if api != nil {
+		if err := server.RegisterName("atmos", api); err != nil {
+			t.Fatalf("failed to register atmos API: %v", err)
+		}
+	}
+	client := rpc.DialInProc(server)
+	return &EthereumClient{ethclient.NewClient(client), client}
+}
+
+// Tests that the Atmos signers and snapshots can be retrieved through the mobile
+// client.
+func TestAtmosAPIs(t *testing.T) {
+	signers := []common.Address{common.HexToAddress("0x01"), common.HexToAddress("0x02")}
+	client := newTestAtmosClient(t, &testAtmosAPI{head: 10, signers: signers})
+
+	for _, number := range []int64{-1, 0, 10} {
+		have, err := client.GetAtmosSigners(NewContext(), number)
+		if err != nil {
+			t.Fatalf("block %d: failed to retrieve signers: %v", number, err)
+		}
+		if !reflect.DeepEqual(have.addresses, signers) {
+			t.Errorf("block %d: signers mismatch: have %x, want %x", number, have.addresses, signers)
+		}
+		blob, err := client.GetAtmosSnapshot(NewContext(), number)
+		if err != nil {
+			t.Fatalf("block %d: failed to retrieve snapshot: %v", number, err)
+		}
+		var snap struct {
+			Number  int64            `json:"number"`
+			Signers []common.Address `json:"signers"`
+		}
+		if err := json.Unmarshal([]byte(blob), &snap); err != nil {
+			t.Fatalf("block %d: failed to parse snapshot: %v", number, err)
+		}
+		want := number
+		if want < 0 {
+			want = 10
+		}
+		if snap.Number != want || !reflect.DeepEqual(snap.Signers, signers) {
+			t.Errorf("block %d: snapshot mismatch: have %s", number, blob)
+		}
+	}
+	if _, err := client.GetAtmosSnapshot(NewContext(), 11); err == nil {
+		t.Errorf("snapshot of unknown block retrieved")
+	}
+}
+
+// Tests that nodes without the Atmos APIs, such as light clients, are reported
+// with a descriptive error.
+func TestAtmosAPIsUnavailable(t *testing.T) {
+	client := newTestAtmosClient(t, nil)
+
+	if _, err := client.GetAtmosSigners(NewContext(), -1); err != errAtmosUnavailable {
+		t.Errorf("signers error mismatch: have %v, want %v", err, errAtmosUnavailable)
+	}
+	if _, err := client.GetAtmosSnapshot(NewContext(), -1); err != errAtmosUnavailable {
+		t.Errorf("snapshot error mismatch: have %v, want %v", err, errAtmosUnavailable)
+	}
+}
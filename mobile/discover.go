@@ -23,6 +23,7 @@ import (
 	"errors"
 
 	"github.com/AERUMTechnology/go-aerum/p2p/discv5"
+	"github.com/AERUMTechnology/go-aerum/p2p/enode"
 )
 
 // Enode represents a host on the network.
@@ -102,3 +103,16 @@ func (e *Enodes) Set(index int, enode *Enode) error {
 func (e *Enodes) Append(enode *Enode) {
 	e.nodes = append(e.nodes, enode.node)
 }
+
+// v4 converts the enodes into their discovery v4 representation.
+func (e *Enodes) v4() ([]*enode.Node, error) {
+	nodes := make([]*enode.Node, 0, len(e.nodes))
+	for _, node := range e.nodes {
+		v4, err := enode.ParseV4(node.String())
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, v4)
+	}
+	return nodes, nil
+}
@@ -23,17 +23,22 @@ import (
 
 	"github.com/AERUMTechnology/go-aerum/core/types"
 	"github.com/AERUMTechnology/go-aerum/ethclient"
+	"github.com/AERUMTechnology/go-aerum/rpc"
 )
 
 // EthereumClient provides access to the Ethereum APIs.
 type EthereumClient struct {
 	client *ethclient.Client
+	rpc    *rpc.Client // Raw connection for APIs not wrapped by ethclient
 }
 
 // NewEthereumClient connects a client to the given URL.
 func NewEthereumClient(rawurl string) (client *EthereumClient, _ error) {
-	rawClient, err := ethclient.Dial(rawurl)
-	return &EthereumClient{rawClient}, err
+	rawClient, err := rpc.Dial(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	return &EthereumClient{ethclient.NewClient(rawClient), rawClient}, nil
 }
 
 // GetBlockByHash returns the given full block.
@@ -56,7 +61,7 @@ func (ec *EthereumClient) GetBlockByNumber(ctx *Context, number int64) (block *B
 // GetHeaderByHash returns the block header with the given hash.
 func (ec *EthereumClient) GetHeaderByHash(ctx *Context, hash *Hash) (header *Header, _ error) {
 	rawHeader, err := ec.client.HeaderByHash(ctx.context, hash.hash)
-	return &Header{rawHeader}, err
+	return &Header{header: rawHeader}, err
 }
 
 // GetHeaderByNumber returns a block header from the current canonical chain. If number is <0,
@@ -64,10 +69,10 @@ func (ec *EthereumClient) GetHeaderByHash(ctx *Context, hash *Hash) (header *Hea
 func (ec *EthereumClient) GetHeaderByNumber(ctx *Context, number int64) (header *Header, _ error) {
 	if number < 0 {
 		rawHeader, err := ec.client.HeaderByNumber(ctx.context, nil)
-		return &Header{rawHeader}, err
+		return &Header{header: rawHeader}, err
 	}
 	rawHeader, err := ec.client.HeaderByNumber(ctx.context, big.NewInt(number))
-	return &Header{rawHeader}, err
+	return &Header{header: rawHeader}, err
 }
 
 // GetTransactionByHash returns the transaction with the given hash.
@@ -135,7 +140,7 @@ func (ec *EthereumClient) SubscribeNewHead(ctx *Context, handler NewHeadHandler,
 		for {
 			select {
 			case header := <-ch:
-				handler.OnNewHead(&Header{header})
+				handler.OnNewHead(&Header{header: header})
 
 			case err := <-rawSub.Err():
 				if err != nil {
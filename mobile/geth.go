@@ -20,19 +20,27 @@
 package geth
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"path/filepath"
+	"sync"
 
+	ethereum "github.com/AERUMTechnology/go-aerum"
+	"github.com/AERUMTechnology/go-aerum/consensus"
 	"github.com/AERUMTechnology/go-aerum/core"
+	"github.com/AERUMTechnology/go-aerum/core/types"
 	"github.com/AERUMTechnology/go-aerum/eth"
 	"github.com/AERUMTechnology/go-aerum/eth/downloader"
 	"github.com/AERUMTechnology/go-aerum/ethclient"
 	"github.com/AERUMTechnology/go-aerum/ethstats"
+	"github.com/AERUMTechnology/go-aerum/event"
 	"github.com/AERUMTechnology/go-aerum/internal/debug"
 	"github.com/AERUMTechnology/go-aerum/les"
 	"github.com/AERUMTechnology/go-aerum/node"
 	"github.com/AERUMTechnology/go-aerum/p2p"
+	"github.com/AERUMTechnology/go-aerum/p2p/enode"
 	"github.com/AERUMTechnology/go-aerum/p2p/nat"
 	"github.com/AERUMTechnology/go-aerum/params"
 	whisper "github.com/AERUMTechnology/go-aerum/whisper/whisperv6"
@@ -46,10 +54,22 @@ type NodeConfig struct {
 	// Bootstrap nodes used to establish connectivity with the rest of the network.
 	BootstrapNodes *Enodes
 
+	// EnableDiscoveryV4 specifies whether the node should also take part in the
+	// classic discovery v4 peer finding, bootstrapping off the same nodes.
+	EnableDiscoveryV4 bool
+
 	// MaxPeers is the maximum number of peers that can be connected. If this is
 	// set to zero, then only the configured static and trusted peers can connect.
 	MaxPeers int
 
+	// ListenPort is the network port to listen on for peer connections. If this
+	// is set to zero, a random port is picked.
+	ListenPort int
+
+	// NATMode is the NAT port mapping mechanism to use, one of "any", "none",
+	// "upnp", "pmp" or "extip:<ip>". An empty mode defaults to "any".
+	NATMode string
+
 	// EthereumEnabled specifies whether the node should run the Ethereum protocol.
 	EthereumEnabled bool
 
@@ -65,6 +85,24 @@ type NodeConfig struct {
 	// A minimum of 16MB is always reserved.
 	EthereumDatabaseCache int
 
+	// TrieCache is the system memory in MB to allocate for trie caching, split
+	// evenly between clean and dirty trie nodes. If this is set to zero, the
+	// default trie caches are used.
+	TrieCache int
+
+	// CacheLimit is the ceiling in MB the database and trie caches may add up to.
+	CacheLimit int
+
+	// SyncMode is the blockchain synchronisation mode to run the Ethereum
+	// protocol with, one of "light", "fast" or "full". Light mode runs a light
+	// client, the others a full node. An empty mode defaults to light.
+	SyncMode string
+
+	// AtmosTestNet specifies whether the Atmos consensus engine should track the
+	// governance contract of the Aerum test network (on Rinkeby) instead of the
+	// main one. It requires an Atmos genesis to be configured.
+	AtmosTestNet bool
+
 	// EthereumNetStats is a netstats connection string to use to report various
 	// chain, transaction and node stats to a monitoring server.
 	//
@@ -85,9 +123,14 @@ var defaultNodeConfig = &NodeConfig{
 	MaxPeers:              25,
 	EthereumEnabled:       true,
 	EthereumNetworkID:     1,
-	EthereumDatabaseCache: 16,
+	EthereumDatabaseCache: minDatabaseCache,
+	CacheLimit:            1024,
 }
 
+// minDatabaseCache is the minimum system memory in MB always reserved for
+// database caching.
+const minDatabaseCache = 16
+
 // NewNodeConfig creates a new node option set, initialized to the default values.
 func NewNodeConfig() *NodeConfig {
 	config := *defaultNodeConfig
@@ -97,6 +140,9 @@ func NewNodeConfig() *NodeConfig {
 // Node represents a Geth Ethereum node instance.
 type Node struct {
 	node *node.Node
+
+	subs map[event.Subscription]struct{} // Head subscriptions to tear down on stop
+	lock sync.Mutex                      // Lock protecting the subscription set
 }
 
 // NewNode creates and configures a new Geth node.
@@ -111,34 +157,14 @@ func NewNode(datadir string, config *NodeConfig) (stack *Node, _ error) {
 	if config.BootstrapNodes == nil || config.BootstrapNodes.Size() == 0 {
 		config.BootstrapNodes = defaultNodeConfig.BootstrapNodes
 	}
+	if config.CacheLimit == 0 {
+		config.CacheLimit = defaultNodeConfig.CacheLimit
+	}
 
 	if config.PprofAddress != "" {
 		debug.StartPProf(config.PprofAddress)
 	}
 
-	// Create the empty networking stack
-	nodeConf := &node.Config{
-		Name:        clientIdentifier,
-		Version:     params.VersionWithMeta,
-		DataDir:     datadir,
-		KeyStoreDir: filepath.Join(datadir, "keystore"), // Mobile should never use internal keystores!
-		P2P: p2p.Config{
-			NoDiscovery:      true,
-			DiscoveryV5:      true,
-			BootstrapNodesV5: config.BootstrapNodes.nodes,
-			ListenAddr:       ":0",
-			NAT:              nat.Any(),
-			MaxPeers:         config.MaxPeers,
-		},
-	}
-
-	rawStack, err := node.New(nodeConf)
-	if err != nil {
-		return nil, err
-	}
-
-	debug.Memsize.Add("node", rawStack)
-
 	var genesis *core.Genesis
 	if config.EthereumGenesis != "" {
 		// Parse the user supplied genesis spec if not mainnet
@@ -154,25 +180,62 @@ func NewNode(datadir string, config *NodeConfig) (stack *Node, _ error) {
 			}
 		}
 	}
+	if config.AtmosTestNet {
+		var err error
+		if genesis, err = atmosTestNetGenesis(genesis); err != nil {
+			return nil, err
+		}
+	}
+	var ethConf *eth.Config
+	if config.EthereumEnabled {
+		var err error
+		if ethConf, err = newEthConfig(config, genesis); err != nil {
+			return nil, err
+		}
+	}
+	// Create the empty networking stack
+	p2pConf, err := newP2PConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	nodeConf := &node.Config{
+		Name:        clientIdentifier,
+		Version:     params.VersionWithMeta,
+		DataDir:     datadir,
+		KeyStoreDir: filepath.Join(datadir, "keystore"), // Mobile should never use internal keystores!
+		P2P:         p2pConf,
+	}
+
+	rawStack, err := node.New(nodeConf)
+	if err != nil {
+		return nil, err
+	}
+
+	debug.Memsize.Add("node", rawStack)
+
 	// Register the Ethereum protocol if requested
 	if config.EthereumEnabled {
-		ethConf := eth.DefaultConfig
-		ethConf.Genesis = genesis
-		ethConf.SyncMode = downloader.LightSync
-		ethConf.NetworkId = uint64(config.EthereumNetworkID)
-		ethConf.DatabaseCache = config.EthereumDatabaseCache
 		if err := rawStack.Register(func(ctx *node.ServiceContext) (node.Service, error) {
-			return les.New(ctx, &ethConf)
+			if ethConf.SyncMode == downloader.LightSync {
+				return les.New(ctx, ethConf)
+			}
+			return eth.New(ctx, ethConf)
 		}); err != nil {
 			return nil, fmt.Errorf("ethereum init: %v", err)
 		}
 		// If netstats reporting is requested, do it
 		if config.EthereumNetStats != "" {
 			if err := rawStack.Register(func(ctx *node.ServiceContext) (node.Service, error) {
-				var lesServ *les.LightEthereum
-				ctx.Service(&lesServ)
-
-				return ethstats.New(config.EthereumNetStats, nil, lesServ)
+				var (
+					ethServ *eth.Ethereum
+					lesServ *les.LightEthereum
+				)
+				if ethConf.SyncMode == downloader.LightSync {
+					ctx.Service(&lesServ)
+				} else {
+					ctx.Service(&ethServ)
+				}
+				return ethstats.New(config.EthereumNetStats, ethServ, lesServ)
 			}); err != nil {
 				return nil, fmt.Errorf("netstats init: %v", err)
 			}
@@ -186,12 +249,91 @@ func NewNode(datadir string, config *NodeConfig) (stack *Node, _ error) {
 			return nil, fmt.Errorf("whisper init: %v", err)
 		}
 	}
-	return &Node{rawStack}, nil
+	return &Node{node: rawStack, subs: make(map[event.Subscription]struct{})}, nil
+}
+
+// atmosTestNetGenesis returns a copy of an Atmos genesis with the consensus engine
+// switched over to the governance contract of the Aerum test network.
+func atmosTestNetGenesis(genesis *core.Genesis) (*core.Genesis, error) {
+	if genesis == nil || genesis.Config == nil || genesis.Config.Atmos == nil {
+		return nil, errors.New("atmos testnet requires an atmos genesis")
+	}
+	config, atmos := *genesis.Config, *genesis.Config.Atmos
+	atmos.EnableTestNet = true
+	atmos.GovernanceAddress = params.NewAtmosTestGovernanceAddress()
+	atmos.EthereumApiEndpoint = params.NewAtmosTestEthereumRPCProvider()
+	atmos.EthereumApiEndpoints = nil
+	config.Atmos = &atmos
+
+	testnet := *genesis
+	testnet.Config = &config
+	return &testnet, nil
+}
+
+// newEthConfig assembles the Ethereum protocol configs of a mobile node.
+func newEthConfig(config *NodeConfig, genesis *core.Genesis) (*eth.Config, error) {
+	ethConf := eth.DefaultConfig
+	ethConf.Genesis = genesis
+	ethConf.SyncMode = downloader.LightSync
+	ethConf.NetworkId = uint64(config.EthereumNetworkID)
+
+	if config.SyncMode != "" {
+		if err := ethConf.SyncMode.UnmarshalText([]byte(config.SyncMode)); err != nil {
+			return nil, fmt.Errorf("invalid sync mode: %v", err)
+		}
+	}
+	// Assign the caches, ensuring they fit into the allowed memory
+	ethConf.DatabaseCache = config.EthereumDatabaseCache
+	if ethConf.DatabaseCache < minDatabaseCache {
+		ethConf.DatabaseCache = minDatabaseCache
+	}
+	if config.TrieCache < 0 {
+		return nil, fmt.Errorf("invalid trie cache %dMB", config.TrieCache)
+	}
+	if config.TrieCache > 0 {
+		ethConf.TrieCleanCache = config.TrieCache / 2
+		ethConf.TrieDirtyCache = config.TrieCache - ethConf.TrieCleanCache
+	}
+	if total := ethConf.DatabaseCache + ethConf.TrieCleanCache + ethConf.TrieDirtyCache; total > config.CacheLimit {
+		return nil, fmt.Errorf("caches of %dMB exceed the %dMB limit", total, config.CacheLimit)
+	}
+	return &ethConf, nil
+}
+
+// newP2PConfig assembles the peer-to-peer networking configs of a mobile node.
+func newP2PConfig(config *NodeConfig) (p2p.Config, error) {
+	if config.ListenPort < 0 || config.ListenPort > 65535 {
+		return p2p.Config{}, fmt.Errorf("invalid listen port %d", config.ListenPort)
+	}
+	mode := config.NATMode
+	if mode == "" {
+		mode = "any"
+	}
+	natm, err := nat.Parse(mode)
+	if err != nil {
+		return p2p.Config{}, fmt.Errorf("invalid NAT mode %q: %v", config.NATMode, err)
+	}
+	p2pConf := p2p.Config{
+		NoDiscovery:      true,
+		DiscoveryV5:      true,
+		BootstrapNodesV5: config.BootstrapNodes.nodes,
+		ListenAddr:       fmt.Sprintf(":%d", config.ListenPort),
+		NAT:              natm,
+		MaxPeers:         config.MaxPeers,
+	}
+	if config.EnableDiscoveryV4 {
+		if p2pConf.BootstrapNodes, err = config.BootstrapNodes.v4(); err != nil {
+			return p2p.Config{}, fmt.Errorf("invalid v4 bootstrap node: %v", err)
+		}
+		p2pConf.NoDiscovery = false
+	}
+	return p2pConf, nil
 }
 
 // Close terminates a running node along with all it's services, tearing internal
 // state doen too. It's not possible to restart a closed node.
 func (n *Node) Close() error {
+	n.unsubscribeAll()
 	return n.node.Close()
 }
 
@@ -203,6 +345,7 @@ func (n *Node) Start() error {
 // Stop terminates a running node along with all it's services. If the node was
 // not started, an error is returned.
 func (n *Node) Stop() error {
+	n.unsubscribeAll()
 	return n.node.Stop()
 }
 
@@ -212,7 +355,7 @@ func (n *Node) GetEthereumClient() (client *EthereumClient, _ error) {
 	if err != nil {
 		return nil, err
 	}
-	return &EthereumClient{ethclient.NewClient(rpc)}, nil
+	return &EthereumClient{ethclient.NewClient(rpc), rpc}, nil
 }
 
 // GetNodeInfo gathers and returns a collection of metadata known about the host.
@@ -224,3 +367,161 @@ func (n *Node) GetNodeInfo() *NodeInfo {
 func (n *Node) GetPeersInfo() *PeerInfos {
 	return &PeerInfos{n.node.Server().PeersInfo()}
 }
+
+// AddPeer connects to the given remote node, maintaining the connection at all
+// times, even reconnecting if it's lost.
+func (n *Node) AddPeer(rawurl string) error {
+	peer, server, err := n.parsePeer(rawurl)
+	if err != nil {
+		return err
+	}
+	server.AddPeer(peer)
+	return nil
+}
+
+// RemovePeer disconnects from the given remote node, if the connection exists.
+func (n *Node) RemovePeer(rawurl string) error {
+	peer, server, err := n.parsePeer(rawurl)
+	if err != nil {
+		return err
+	}
+	server.RemovePeer(peer)
+	return nil
+}
+
+// AddTrustedPeer allows the given remote node to always connect, even if the
+// peer slots are full.
+func (n *Node) AddTrustedPeer(rawurl string) error {
+	peer, server, err := n.parsePeer(rawurl)
+	if err != nil {
+		return err
+	}
+	server.AddTrustedPeer(peer)
+	return nil
+}
+
+// parsePeer parses a remote node URL and retrieves the running p2p server to
+// manage it through.
+func (n *Node) parsePeer(rawurl string) (*enode.Node, *p2p.Server, error) {
+	peer, err := enode.ParseV4(rawurl)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid enode %q: %v", rawurl, err)
+	}
+	server := n.node.Server()
+	if server == nil {
+		return nil, nil, node.ErrNodeStopped
+	}
+	return peer, server, nil
+}
+
+// progressReader is the part of the downloader reporting the sync progress.
+type progressReader interface {
+	Progress() ethereum.SyncProgress
+}
+
+// GetSyncProgress retrieves the current progress of the sync algorithm of the
+// embedded Ethereum service. If there's no sync currently running, it returns nil.
+func (n *Node) GetSyncProgress() (progress *SyncProgress, _ error) {
+	var (
+		ethServ *eth.Ethereum
+		lesServ *les.LightEthereum
+	)
+	if err := n.node.Service(&lesServ); err == nil {
+		return newSyncProgress(lesServ.Downloader()), nil
+	}
+	if err := n.node.Service(&ethServ); err != nil {
+		return nil, fmt.Errorf("ethereum service not running: %v", err)
+	}
+	return newSyncProgress(ethServ.Downloader()), nil
+}
+
+// newSyncProgress wraps the progress reported by a downloader, returning nil if
+// there's no sync currently running.
+func newSyncProgress(downloader progressReader) *SyncProgress {
+	progress := downloader.Progress()
+	if progress.CurrentBlock >= progress.HighestBlock {
+		return nil
+	}
+	return &SyncProgress{progress}
+}
+
+// SubscribeNewHead subscribes to notifications about the new heads of the local
+// chain, each carrying the signer recovered by the consensus engine. The
+// subscription is torn down when the node is stopped.
+func (n *Node) SubscribeNewHead(handler NewHeadHandler) (sub *Subscription, _ error) {
+	// Retrieve the consensus engine to recover the signers with
+	var (
+		ethServ *eth.Ethereum
+		lesServ *les.LightEthereum
+		engine  consensus.Engine
+	)
+	if err := n.node.Service(&lesServ); err == nil {
+		engine = lesServ.Engine()
+	} else if err := n.node.Service(&ethServ); err == nil {
+		engine = ethServ.Engine()
+	} else {
+		return nil, fmt.Errorf("ethereum service not running: %v", err)
+	}
+	// Subscribe to the new heads through an in-process client
+	rpc, err := n.node.Attach()
+	if err != nil {
+		return nil, err
+	}
+	ch := make(chan *types.Header, 16)
+	rawSub, err := ethclient.NewClient(rpc).SubscribeNewHead(context.Background(), ch)
+	if err != nil {
+		rpc.Close()
+		return nil, err
+	}
+	// Start up a dispatcher to feed into the callback, tracking it until done
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	var headSub event.Subscription
+	headSub = event.NewSubscription(func(quit <-chan struct{}) error {
+		defer rpc.Close()
+		defer rawSub.Unsubscribe()
+		defer func() {
+			n.lock.Lock()
+			delete(n.subs, headSub)
+			n.lock.Unlock()
+		}()
+
+		for {
+			select {
+			case header := <-ch:
+				head := &Header{header: header}
+				if signer, err := engine.Author(header); err == nil {
+					head.signer = &signer
+				}
+				handler.OnNewHead(head)
+
+			case err := <-rawSub.Err():
+				if err != nil {
+					handler.OnError(err.Error())
+				}
+				return err
+
+			case <-quit:
+				return nil
+			}
+		}
+	})
+	n.subs[headSub] = struct{}{}
+
+	return &Subscription{headSub}, nil
+}
+
+// unsubscribeAll tears down all the live head subscriptions.
+func (n *Node) unsubscribeAll() {
+	n.lock.Lock()
+	subs := make([]event.Subscription, 0, len(n.subs))
+	for sub := range n.subs {
+		subs = append(subs, sub)
+	}
+	n.lock.Unlock()
+
+	for _, sub := range subs {
+		sub.Unsubscribe()
+	}
+}
@@ -0,0 +1,498 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package geth
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	ethereum "github.com/AERUMTechnology/go-aerum"
+	"github.com/AERUMTechnology/go-aerum/common"
+	"github.com/AERUMTechnology/go-aerum/common/hexutil"
+	"github.com/AERUMTechnology/go-aerum/consensus/clique"
+	"github.com/AERUMTechnology/go-aerum/core"
+	"github.com/AERUMTechnology/go-aerum/core/rawdb"
+	"github.com/AERUMTechnology/go-aerum/crypto"
+	"github.com/AERUMTechnology/go-aerum/eth"
+	"github.com/AERUMTechnology/go-aerum/les"
+	"github.com/AERUMTechnology/go-aerum/params"
+)
+
+// testGenesis is a tiny ethash genesis to avoid syncing any real network.
+const testGenesis = `{"config": {"chainId": 1337, "ethash": {}}, "difficulty": "0x1", "gasLimit": "0x47b760", "alloc": {}}`
+
+// Tests that the sync mode picks between registering a light client and a full
+// node, defaulting to the light client.
+func TestNodeSyncMode(t *testing.T) {
+	tests := []struct {
+		mode  string
+		light bool
+	}{
+		{"", true},
+		{"light", true},
+		{"fast", false},
+		{"full", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			datadir, err := ioutil.TempDir("", "mobile-")
+			if err != nil {
+				t.Fatalf("failed to create temporary datadir: %v", err)
+			}
+			defer os.RemoveAll(datadir)
+
+			config := NewNodeConfig()
+			config.EthereumGenesis = testGenesis
+			config.EthereumNetworkID = 1337
+			config.SyncMode = tt.mode
+
+			stack, err := NewNode(datadir, config)
+			if err != nil {
+				t.Fatalf("failed to create node: %v", err)
+			}
+			if err := stack.Start(); err != nil {
+				t.Fatalf("failed to start node: %v", err)
+			}
+			defer stack.Close()
+
+			var (
+				lesServ *les.LightEthereum
+				ethServ *eth.Ethereum
+			)
+			lesErr, ethErr := stack.node.Service(&lesServ), stack.node.Service(&ethServ)
+			if tt.light && (lesErr != nil || ethErr == nil) {
+				t.Errorf("light client not registered: les %v, eth %v", lesErr, ethErr)
+			}
+			if !tt.light && (ethErr != nil || lesErr == nil) {
+				t.Errorf("full node not registered: les %v, eth %v", lesErr, ethErr)
+			}
+			// A fresh node without peers isn't syncing
+			if progress, err := stack.GetSyncProgress(); progress != nil || err != nil {
+				t.Errorf("sync progress mismatch: have %v/%v, want nil/nil", progress, err)
+			}
+		})
+	}
+	// Unknown sync modes are rejected upfront
+	config := NewNodeConfig()
+	config.SyncMode = "turbo"
+	if _, err := NewNode("", config); err == nil {
+		t.Errorf("invalid sync mode accepted")
+	}
+}
+
+// Tests that the listen port and NAT mode are translated into the networking
+// configs, defaulting to a random port and any NAT mechanism.
+func TestNodeP2PConfig(t *testing.T) {
+	tests := []struct {
+		port int
+		mode string
+		addr string
+		nat  string
+	}{
+		{0, "", ":0", "UPnP or NAT-PMP"},
+		{30303, "any", ":30303", "UPnP or NAT-PMP"},
+		{0, "none", ":0", ""},
+		{0, "upnp", ":0", "UPnP"},
+		{0, "pmp", ":0", "NAT-PMP"},
+		{0, "extip:1.2.3.4", ":0", "ExtIP(1.2.3.4)"},
+	}
+	for i, tt := range tests {
+		config := NewNodeConfig()
+		config.ListenPort = tt.port
+		config.NATMode = tt.mode
+
+		p2pConf, err := newP2PConfig(config)
+		if err != nil {
+			t.Fatalf("test %d: failed to create p2p config: %v", i, err)
+		}
+		if p2pConf.ListenAddr != tt.addr {
+			t.Errorf("test %d: listen address mismatch: have %s, want %s", i, p2pConf.ListenAddr, tt.addr)
+		}
+		if tt.nat == "" && p2pConf.NAT != nil {
+			t.Errorf("test %d: NAT mechanism mismatch: have %v, want none", i, p2pConf.NAT)
+		}
+		if tt.nat != "" && (p2pConf.NAT == nil || p2pConf.NAT.String() != tt.nat) {
+			t.Errorf("test %d: NAT mechanism mismatch: have %v, want %s", i, p2pConf.NAT, tt.nat)
+		}
+	}
+	// Invalid NAT modes and ports are rejected
+	for i, tt := range []struct {
+		port int
+		mode string
+	}{
+		{0, "magic"},
+		{0, "extip"},
+		{0, "extip:1.2.3"},
+		{-1, ""},
+		{65536, ""},
+	} {
+		config := NewNodeConfig()
+		config.ListenPort = tt.port
+		config.NATMode = tt.mode
+
+		if _, err := newP2PConfig(config); err == nil {
+			t.Errorf("test %d: invalid port %d or NAT mode %q accepted", i, tt.port, tt.mode)
+		}
+		if _, err := NewNode("", config); err == nil {
+			t.Errorf("test %d: node created with invalid port %d or NAT mode %q", i, tt.port, tt.mode)
+		}
+	}
+}
+
+// Tests that discovery v4 can be enabled next to discovery v5, bootstrapping off
+// the same nodes.
+func TestNodeDiscoveryConfig(t *testing.T) {
+	bootnode, err := NewEnode("enode://a979fb575495b8d6db44f750317d0f4622bf4c2aa3365d6af7c284339968eef29b69ad0dce72a4d8db5ebb4968de0e3bec910127f134779fbcb0cb6d3331163c@52.16.188.185:30303")
+	if err != nil {
+		t.Fatalf("failed to parse bootnode: %v", err)
+	}
+	for _, v4 := range []bool{false, true} {
+		for _, size := range []int{0, 1} {
+			config := NewNodeConfig()
+			config.EnableDiscoveryV4 = v4
+			config.BootstrapNodes = NewEnodesEmpty()
+			for i := 0; i < size; i++ {
+				config.BootstrapNodes.Append(bootnode)
+			}
+			p2pConf, err := newP2PConfig(config)
+			if err != nil {
+				t.Fatalf("v4 %v, %d bootnodes: failed to create p2p config: %v", v4, size, err)
+			}
+			if p2pConf.NoDiscovery == v4 || !p2pConf.DiscoveryV5 {
+				t.Errorf("v4 %v, %d bootnodes: discovery mismatch: v4 %v, v5 %v", v4, size, !p2pConf.NoDiscovery, p2pConf.DiscoveryV5)
+			}
+			if len(p2pConf.BootstrapNodesV5) != size {
+				t.Errorf("v4 %v, %d bootnodes: v5 bootnode count mismatch: have %d", v4, size, len(p2pConf.BootstrapNodesV5))
+			}
+			want := 0
+			if v4 {
+				want = size
+			}
+			if len(p2pConf.BootstrapNodes) != want {
+				t.Fatalf("v4 %v, %d bootnodes: v4 bootnode count mismatch: have %d, want %d", v4, size, len(p2pConf.BootstrapNodes), want)
+			}
+			if want > 0 && p2pConf.BootstrapNodes[0].String() != bootnode.node.String() {
+				t.Errorf("v4 %v, %d bootnodes: v4 bootnode mismatch: have %s, want %s", v4, size, p2pConf.BootstrapNodes[0], bootnode.node)
+			}
+		}
+	}
+}
+
+// testDownloader is a fake downloader reporting a fixed sync progress.
+type testDownloader struct {
+	progress ethereum.SyncProgress
+}
+
+func (d *testDownloader) Progress() ethereum.SyncProgress { return d.progress }
+
+// Tests that the downloader sync progress is passed through the mobile wrapper,
+// or nil if not syncing.
+func TestSyncProgress(t *testing.T) {
+	progress := newSyncProgress(&testDownloader{ethereum.SyncProgress{
+		StartingBlock: 10,
+		CurrentBlock:  20,
+		HighestBlock:  30,
+		PulledStates:  40,
+		KnownStates:   50,
+	}})
+	if progress == nil {
+		t.Fatalf("sync progress missing mid-sync")
+	}
+	if have := progress.GetStartingBlock(); have != 10 {
+		t.Errorf("starting block mismatch: have %d, want %d", have, 10)
+	}
+	if have := progress.GetCurrentBlock(); have != 20 {
+		t.Errorf("current block mismatch: have %d, want %d", have, 20)
+	}
+	if have := progress.GetHighestBlock(); have != 30 {
+		t.Errorf("highest block mismatch: have %d, want %d", have, 30)
+	}
+	if have := progress.GetPulledStates(); have != 40 {
+		t.Errorf("pulled states mismatch: have %d, want %d", have, 40)
+	}
+	if have := progress.GetKnownStates(); have != 50 {
+		t.Errorf("known states mismatch: have %d, want %d", have, 50)
+	}
+	if progress := newSyncProgress(&testDownloader{ethereum.SyncProgress{CurrentBlock: 30, HighestBlock: 30}}); progress != nil {
+		t.Errorf("sync progress reported when synced: %v", progress)
+	}
+}
+
+// Tests that the database cache floor is enforced, the trie cache propagates and
+// caches exceeding the limit are rejected.
+func TestNodeCacheConfig(t *testing.T) {
+	config := NewNodeConfig()
+	config.EthereumDatabaseCache = 4
+	config.TrieCache = 65
+
+	ethConf, err := newEthConfig(config, nil)
+	if err != nil {
+		t.Fatalf("failed to create eth config: %v", err)
+	}
+	if ethConf.DatabaseCache != minDatabaseCache {
+		t.Errorf("database cache mismatch: have %d, want %d", ethConf.DatabaseCache, minDatabaseCache)
+	}
+	if ethConf.TrieCleanCache != 32 || ethConf.TrieDirtyCache != 33 {
+		t.Errorf("trie cache mismatch: have %d+%d, want %d+%d", ethConf.TrieCleanCache, ethConf.TrieDirtyCache, 32, 33)
+	}
+	// Without a trie cache, the defaults are retained
+	config.TrieCache = 0
+	if ethConf, err = newEthConfig(config, nil); err != nil {
+		t.Fatalf("failed to create default eth config: %v", err)
+	}
+	if ethConf.TrieCleanCache != eth.DefaultConfig.TrieCleanCache || ethConf.TrieDirtyCache != eth.DefaultConfig.TrieDirtyCache {
+		t.Errorf("default trie cache mismatch: have %d+%d", ethConf.TrieCleanCache, ethConf.TrieDirtyCache)
+	}
+	// Invalid and oversized caches are rejected
+	config.TrieCache = -1
+	if _, err := newEthConfig(config, nil); err == nil {
+		t.Errorf("negative trie cache accepted")
+	}
+	config.TrieCache = 64
+	config.CacheLimit = 64
+	if _, err := newEthConfig(config, nil); err == nil {
+		t.Errorf("caches exceeding the limit accepted")
+	}
+	if _, err := NewNode("", config); err == nil {
+		t.Errorf("node created with caches exceeding the limit")
+	}
+}
+
+// newTestPeerNode starts a networking-only node listening on a random port.
+func newTestPeerNode(t *testing.T) (*Node, func()) {
+	datadir, err := ioutil.TempDir("", "mobile-")
+	if err != nil {
+		t.Fatalf("failed to create temporary datadir: %v", err)
+	}
+	config := NewNodeConfig()
+	config.EthereumEnabled = false
+	config.NATMode = "none"
+
+	stack, err := NewNode(datadir, config)
+	if err != nil {
+		t.Fatalf("failed to create node: %v", err)
+	}
+	if err := stack.Start(); err != nil {
+		t.Fatalf("failed to start node: %v", err)
+	}
+	return stack, func() {
+		stack.Close()
+		os.RemoveAll(datadir)
+	}
+}
+
+// waitPeers waits until the node has the given number of peers connected.
+func waitPeers(t *testing.T, stack *Node, peers int) {
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if stack.GetPeersInfo().Size() == peers {
+			return
+		}
+	}
+	t.Fatalf("peer count mismatch: have %d, want %d", stack.GetPeersInfo().Size(), peers)
+}
+
+// Tests that peers can be added to and removed from a running node.
+func TestNodePeerManagement(t *testing.T) {
+	local, closeLocal := newTestPeerNode(t)
+	defer closeLocal()
+	remote, closeRemote := newTestPeerNode(t)
+	defer closeRemote()
+
+	url := remote.GetNodeInfo().GetEnode()
+	if err := local.AddPeer(url); err != nil {
+		t.Fatalf("failed to add peer: %v", err)
+	}
+	waitPeers(t, local, 1)
+
+	if err := local.RemovePeer(url); err != nil {
+		t.Fatalf("failed to remove peer: %v", err)
+	}
+	waitPeers(t, local, 0)
+
+	if err := local.AddTrustedPeer(url); err != nil {
+		t.Fatalf("failed to add trusted peer: %v", err)
+	}
+	// Malformed enodes are rejected with a descriptive error
+	for _, method := range []func(string) error{local.AddPeer, local.RemovePeer, local.AddTrustedPeer} {
+		if err := method("enode://not-a-node"); err == nil || !strings.Contains(err.Error(), "invalid enode") {
+			t.Errorf("error mismatch: have %v, want invalid enode", err)
+		}
+	}
+}
+
+// Tests that the Atmos testnet toggle points the consensus engine at the test
+// governance contract and Ethereum endpoint.
+func TestAtmosTestNetGenesis(t *testing.T) {
+	genesis := &core.Genesis{
+		Config: &params.ChainConfig{
+			ChainID: big.NewInt(538),
+			Atmos: &params.AtmosConfig{
+				Period:               3,
+				Epoch:                100,
+				GovernanceAddress:    params.NewAtmosGovernanceAddress(),
+				EthereumApiEndpoint:  params.NewAtmosEthereumRPCProvider(),
+				EthereumApiEndpoints: []string{"http://localhost:8545"},
+			},
+		},
+	}
+	testnet, err := atmosTestNetGenesis(genesis)
+	if err != nil {
+		t.Fatalf("failed to switch to the testnet: %v", err)
+	}
+	config := testnet.Config.Atmos
+	if !config.EnableTestNet {
+		t.Errorf("testnet not enabled")
+	}
+	if config.GovernanceAddress != params.NewAtmosTestGovernanceAddress() {
+		t.Errorf("governance address mismatch: have %x, want %x", config.GovernanceAddress, params.NewAtmosTestGovernanceAddress())
+	}
+	if config.EthereumApiEndpoint != params.NewAtmosTestEthereumRPCProvider() || len(config.EthereumApiEndpoints) != 0 {
+		t.Errorf("endpoints mismatch: have %s %v, want %s", config.EthereumApiEndpoint, config.EthereumApiEndpoints, params.NewAtmosTestEthereumRPCProvider())
+	}
+	if config.Period != 3 || config.Epoch != 100 {
+		t.Errorf("consensus parameters lost: period %d, epoch %d", config.Period, config.Epoch)
+	}
+	// The original genesis must be left untouched
+	if genesis.Config.Atmos.EnableTestNet || genesis.Config.Atmos.EthereumApiEndpoint != params.NewAtmosEthereumRPCProvider() {
+		t.Errorf("original genesis modified: %+v", genesis.Config.Atmos)
+	}
+	// Non-Atmos genesis blocks can't be switched to the testnet
+	for i, genesis := range []*core.Genesis{nil, {Config: params.TestnetChainConfig}} {
+		if _, err := atmosTestNetGenesis(genesis); err == nil {
+			t.Errorf("test %d: non-atmos genesis switched to the testnet", i)
+		}
+	}
+	nodeConfig := NewNodeConfig()
+	nodeConfig.AtmosTestNet = true
+	if _, err := NewNode("", nodeConfig); err == nil {
+		t.Errorf("node created on the atmos testnet without an atmos genesis")
+	}
+}
+
+// testHeadHandler is a head subscription callback collecting the delivered heads.
+type testHeadHandler struct {
+	heads chan *Header
+}
+
+func (h *testHeadHandler) OnNewHead(header *Header) { h.heads <- header }
+func (h *testHeadHandler) OnError(failure string)   {}
+
+// Tests that new heads are delivered to subscribers along with their signers,
+// and that the subscriptions are torn down when the node stops.
+func TestNodeSubscribeNewHead(t *testing.T) {
+	// Create a single signer clique genesis to seal blocks in-process
+	key, _ := crypto.GenerateKey()
+	addr := crypto.PubkeyToAddress(key.PublicKey)
+
+	extra := make([]byte, 32+common.AddressLength+65)
+	copy(extra[32:], addr[:])
+	spec := fmt.Sprintf(`{"config": {"chainId": 1337, "clique": {"period": 1, "epoch": 30000}}, "difficulty": "0x1", "gasLimit": "0x47b760", "extraData": "%s", "alloc": {}}`, hexutil.Encode(extra))
+
+	datadir, err := ioutil.TempDir("", "mobile-")
+	if err != nil {
+		t.Fatalf("failed to create temporary datadir: %v", err)
+	}
+	defer os.RemoveAll(datadir)
+
+	config := NewNodeConfig()
+	config.EthereumGenesis = spec
+	config.EthereumNetworkID = 1337
+	config.SyncMode = "full"
+	config.NATMode = "none"
+
+	stack, err := NewNode(datadir, config)
+	if err != nil {
+		t.Fatalf("failed to create node: %v", err)
+	}
+	if err := stack.Start(); err != nil {
+		t.Fatalf("failed to start node: %v", err)
+	}
+	defer stack.Close()
+
+	var ethServ *eth.Ethereum
+	if err := stack.node.Service(&ethServ); err != nil {
+		t.Fatalf("failed to retrieve ethereum service: %v", err)
+	}
+	handler := &testHeadHandler{heads: make(chan *Header, 16)}
+	sub, err := stack.SubscribeNewHead(handler)
+	if err != nil {
+		t.Fatalf("failed to subscribe to new heads: %v", err)
+	}
+	// The filter system installs the subscription asynchronously, wait a bit
+	time.Sleep(250 * time.Millisecond)
+
+	// Generate a couple of signed blocks and import them into the node
+	genesis := new(core.Genesis)
+	if err := json.Unmarshal([]byte(spec), genesis); err != nil {
+		t.Fatalf("failed to parse genesis: %v", err)
+	}
+	db := rawdb.NewMemoryDatabase()
+	engine := clique.New(genesis.Config.Clique, db)
+
+	blocks, _ := core.GenerateChain(genesis.Config, genesis.MustCommit(db), engine, db, 2, func(i int, block *core.BlockGen) {
+		block.SetDifficulty(big.NewInt(2))
+	})
+	for i, block := range blocks {
+		header := block.Header()
+		if i > 0 {
+			header.ParentHash = blocks[i-1].Hash()
+		}
+		header.Extra = make([]byte, 32+65)
+		sig, _ := crypto.Sign(clique.SealHash(header).Bytes(), key)
+		copy(header.Extra[32:], sig)
+		blocks[i] = block.WithSeal(header)
+	}
+	// Import the blocks one by one, ensuring the heads arrive in order with
+	// their signers recovered
+	for i, block := range blocks {
+		if _, err := ethServ.BlockChain().InsertChain(blocks[i : i+1]); err != nil {
+			t.Fatalf("failed to import block %d: %v", block.NumberU64(), err)
+		}
+		want := int64(block.NumberU64())
+		select {
+		case head := <-handler.heads:
+			if have := head.GetNumber(); have != want {
+				t.Errorf("head number mismatch: have %d, want %d", have, want)
+			}
+			if have := head.GetSigner(); have == nil || have.address != addr {
+				t.Errorf("head %d signer mismatch: have %v, want %x", want, have, addr)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for head %d", want)
+		}
+	}
+	// Stopping the node must tear down the live subscriptions
+	if err := stack.Stop(); err != nil {
+		t.Fatalf("failed to stop node: %v", err)
+	}
+	select {
+	case <-sub.sub.Err():
+	case <-time.After(time.Second):
+		t.Fatalf("subscription not torn down on stop")
+	}
+	stack.lock.Lock()
+	defer stack.lock.Unlock()
+	if len(stack.subs) != 0 {
+		t.Errorf("tracked subscriptions mismatch: have %d, want 0", len(stack.subs))
+	}
+}
@@ -63,6 +63,7 @@ func (b *Bloom) GetHex() string {
 // Header represents a block header in the Ethereum blockchain.
 type Header struct {
 	header *types.Header
+	signer *common.Address // Sealer recovered by the consensus engine, if known
 }
 
 // NewHeaderFromRLP parses a header from an RLP data dump.
@@ -115,6 +116,16 @@ func (h *Header) GetMixDigest() *Hash    { return &Hash{h.header.MixDigest} }
 func (h *Header) GetNonce() *Nonce       { return &Nonce{h.header.Nonce} }
 func (h *Header) GetHash() *Hash         { return &Hash{h.header.Hash()} }
 
+// GetSigner returns the account that sealed the header, as recovered by the
+// consensus engine. It is only available on headers delivered by a node's head
+// subscription, returning nil otherwise.
+func (h *Header) GetSigner() *Address {
+	if h.signer == nil {
+		return nil
+	}
+	return &Address{*h.signer}
+}
+
 // Headers represents a slice of headers.
 type Headers struct{ headers []*types.Header }
 
@@ -128,7 +139,7 @@ func (h *Headers) Get(index int) (header *Header, _ error) {
 	if index < 0 || index >= len(h.headers) {
 		return nil, errors.New("index out of bounds")
 	}
-	return &Header{h.headers[index]}, nil
+	return &Header{header: h.headers[index]}, nil
 }
 
 // Block represents an entire block in the Ethereum blockchain.
@@ -185,7 +196,7 @@ func (b *Block) GetExtra() []byte               { return b.block.Extra() }
 func (b *Block) GetMixDigest() *Hash            { return &Hash{b.block.MixDigest()} }
 func (b *Block) GetNonce() int64                { return int64(b.block.Nonce()) }
 func (b *Block) GetHash() *Hash                 { return &Hash{b.block.Hash()} }
-func (b *Block) GetHeader() *Header             { return &Header{b.block.Header()} }
+func (b *Block) GetHeader() *Header             { return &Header{header: b.block.Header()} }
 func (b *Block) GetUncles() *Headers            { return &Headers{b.block.Uncles()} }
 func (b *Block) GetTransactions() *Transactions { return &Transactions{b.block.Transactions()} }
 func (b *Block) GetTransaction(hash *Hash) *Transaction {
@@ -1,62 +1,202 @@
 package params
 
 import (
-	"github.com/AERUMTechnology/go-aerum/common"
+	"errors"
+	"fmt"
 	"math/big"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/AERUMTechnology/go-aerum/common"
 )
 
+// AtmosParams is the set of network parameters of an Atmos based Aerum chain.
+type AtmosParams struct {
+	MinDelegateNo           int      // Minimum number of delegates needed to seal blocks
+	NetID                   int      // Network and chain identifier
+	GovernanceAddress       string   // Hex address of the governance contract on Ethereum
+	TestGovernanceAddress   string   // Hex address of the governance contract on the Ethereum testnet
+	BlockInterval           uint64   // Minimum difference between two consecutive block's timestamps
+	EpochInterval           uint64   // Number of blocks after which to checkpoint the signers
+	GasLimit                uint64   // Genesis gas limit
+	EthereumRPCProvider     string   // Ethereum RPC endpoint used for governance lookups
+	TestEthereumRPCProvider string   // Ethereum testnet RPC endpoint used for governance lookups
+	BlockRewards            *big.Int // Block reward in wei for successfully sealing a block
+}
+
+// Validate checks that the parameters describe a usable Atmos network.
+func (p AtmosParams) Validate() error {
+	switch {
+	case p.MinDelegateNo < 2:
+		return fmt.Errorf("invalid minimum delegate count %d: must be at least 2", p.MinDelegateNo)
+	case p.NetID <= 0:
+		return fmt.Errorf("invalid network id %d: must be positive", p.NetID)
+	case !common.IsHexAddress(p.GovernanceAddress):
+		return fmt.Errorf("invalid governance address %q", p.GovernanceAddress)
+	case !common.IsHexAddress(p.TestGovernanceAddress):
+		return fmt.Errorf("invalid test governance address %q", p.TestGovernanceAddress)
+	case p.BlockInterval == 0:
+		return errors.New("invalid block interval: must be positive")
+	case p.EpochInterval == 0:
+		return errors.New("invalid epoch interval: must be positive")
+	case p.GasLimit == 0:
+		return errors.New("invalid gas limit: must be positive")
+	case p.EthereumRPCProvider == "":
+		return errors.New("invalid Ethereum RPC provider: must not be empty")
+	case p.TestEthereumRPCProvider == "":
+		return errors.New("invalid Ethereum testnet RPC provider: must not be empty")
+	case p.BlockRewards == nil || p.BlockRewards.Sign() < 0:
+		return fmt.Errorf("invalid block rewards %v: must be non-negative", p.BlockRewards)
+	}
+	return nil
+}
+
 // Values for AERUMS Genesis related to ATMOS Consensus
 var (
-	atmosMinDelegateNo           = 3
-	atmosNetID                   = 538
-	atmosGovernanceAddress       = "0x7f07f6627e9bf1fc821360e0c20f32af532df106"
-	atmosTestGovernanceAddress   = "0x02c362540efc9FA5592621C9212D0bF776732050"
-	atmosBlockInterval           = uint64(3)
-	atmosEpochInterval           = uint64(100)
-	atmosGasLimit                = uint64(126000000)
-	atmosEthereumRPCProvider     = "https://mainnet.infura.io"
-	atmosTestEthereumRPCProvider = "https://rinkeby.infura.io"
-	atmosBlockRewards            = new(big.Int).Mul(big.NewInt(888),big.NewInt(1e+18))
+	atmosParams = AtmosParams{
+		MinDelegateNo:           3,
+		NetID:                   538,
+		GovernanceAddress:       "0x7f07f6627e9bf1fc821360e0c20f32af532df106",
+		TestGovernanceAddress:   "0x02c362540efc9FA5592621C9212D0bF776732050",
+		BlockInterval:           uint64(3),
+		EpochInterval:           uint64(100),
+		GasLimit:                uint64(126000000),
+		EthereumRPCProvider:     "https://mainnet.infura.io",
+		TestEthereumRPCProvider: "https://rinkeby.infura.io",
+		BlockRewards:            new(big.Int).Mul(big.NewInt(888), big.NewInt(1e+18)),
+	}
+	atmosParamsLock sync.RWMutex
+)
+
+// Environment variables overriding the built-in Atmos network parameters, meant
+// for spinning up ephemeral testnets without recompiling. When set, they take
+// precedence over the defaults above.
+const (
+	envAtmosNetID               = "AERUM_NET_ID"
+	envAtmosGovernanceAddress   = "AERUM_GOVERNANCE_ADDRESS"
+	envAtmosEthereumRPCProvider = "AERUM_ETHEREUM_RPC_PROVIDER"
+	envAtmosEpochInterval       = "AERUM_EPOCH_INTERVAL"
 )
 
+// atmosParamsEnvErr is the error encountered applying the environment overrides
+// at package initialisation, if any.
+var atmosParamsEnvErr error
+
+func init() {
+	// An invalid environment must not crash every tool importing params, keep the
+	// built-in parameters instead and leave it up to the node to refuse starting
+	atmosParamsEnvErr = LoadAtmosParamsFromEnv()
+}
+
+// AtmosParamsEnvError returns the error encountered applying the AERUM_*
+// environment overrides at package initialisation, in which case the built-in
+// parameters remained in effect.
+func AtmosParamsEnvError() error {
+	return atmosParamsEnvErr
+}
+
+// GetAtmosParams returns a copy of the current Atmos network parameters.
+func GetAtmosParams() AtmosParams {
+	atmosParamsLock.RLock()
+	defer atmosParamsLock.RUnlock()
+
+	p := atmosParams
+	p.BlockRewards = new(big.Int).Set(atmosParams.BlockRewards)
+	return p
+}
+
+// SetAtmosParams validates and replaces all the Atmos network parameters at
+// once, allowing go-aerum to be embedded as a library with a custom network.
+// Invalid parameters are rejected, leaving the current ones untouched.
+func SetAtmosParams(p AtmosParams) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	p.BlockRewards = new(big.Int).Set(p.BlockRewards)
+
+	atmosParamsLock.Lock()
+	defer atmosParamsLock.Unlock()
+
+	atmosParams = p
+	return nil
+}
+
+// LoadAtmosParamsFromEnv overrides the built-in Atmos network parameters with
+// any AERUM_* environment variables that are set. All variables are validated
+// before any of them is applied, so an invalid environment leaves the current
+// parameters untouched. It is called once at package initialisation, where a
+// failure is recorded for AtmosParamsEnvError.
+func LoadAtmosParamsFromEnv() error {
+	p := GetAtmosParams()
+
+	if value, ok := os.LookupEnv(envAtmosNetID); ok {
+		id, err := strconv.Atoi(value)
+		if err != nil || id <= 0 {
+			return fmt.Errorf("invalid %s %q: must be a positive integer", envAtmosNetID, value)
+		}
+		p.NetID = id
+	}
+	if value, ok := os.LookupEnv(envAtmosGovernanceAddress); ok {
+		if !common.IsHexAddress(value) {
+			return fmt.Errorf("invalid %s %q: must be a hex address", envAtmosGovernanceAddress, value)
+		}
+		p.GovernanceAddress = value
+	}
+	if value, ok := os.LookupEnv(envAtmosEthereumRPCProvider); ok {
+		if value == "" {
+			return fmt.Errorf("invalid %s: must not be empty", envAtmosEthereumRPCProvider)
+		}
+		p.EthereumRPCProvider = value
+	}
+	if value, ok := os.LookupEnv(envAtmosEpochInterval); ok {
+		interval, err := strconv.ParseUint(value, 10, 64)
+		if err != nil || interval == 0 {
+			return fmt.Errorf("invalid %s %q: must be a positive integer", envAtmosEpochInterval, value)
+		}
+		p.EpochInterval = interval
+	}
+	return SetAtmosParams(p)
+}
+
 func NewAtmosMinDelegateNo() int {
-	return atmosMinDelegateNo
+	return GetAtmosParams().MinDelegateNo
 }
 
 func NewAtmosNetID() int {
-	return atmosNetID
+	return GetAtmosParams().NetID
 }
 
 func NewAtmosGovernanceAddress() common.Address {
-	return common.HexToAddress(atmosGovernanceAddress)
+	return common.HexToAddress(GetAtmosParams().GovernanceAddress)
 }
 
 func NewAtmosTestGovernanceAddress() common.Address {
-	return common.HexToAddress(atmosTestGovernanceAddress)
+	return common.HexToAddress(GetAtmosParams().TestGovernanceAddress)
 }
 
 func NewAtmosBlockInterval() uint64 {
-	return atmosBlockInterval
+	return GetAtmosParams().BlockInterval
 }
 
 func NewAtmosEpochInterval() uint64 {
-	return atmosEpochInterval
+	return GetAtmosParams().EpochInterval
 }
 
 func NewAtmosGasLimit() uint64 {
-	return atmosGasLimit
+	return GetAtmosParams().GasLimit
 }
 
 func NewAtmosEthereumRPCProvider() string {
-	return atmosEthereumRPCProvider
+	return GetAtmosParams().EthereumRPCProvider
 }
 
 func NewAtmosTestEthereumRPCProvider() string {
-	return atmosTestEthereumRPCProvider
+	return GetAtmosParams().TestEthereumRPCProvider
 }
 
 func NewAtmosBlockRewards() *big.Int {
-	return atmosBlockRewards
+	return GetAtmosParams().BlockRewards
 }
 
 func NewAerumPreAlloc() map[string]string {
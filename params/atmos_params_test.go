@@ -0,0 +1,176 @@
+// Copyright 2017 The go-aerum Authors
+// This file is part of the go-aerum library.
+//
+// The go-aerum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-aerum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-aerum library. If not, see <http://www.gnu.org/licenses/>.
+
+package params
+
+import (
+	"math/big"
+	"os"
+	"testing"
+
+	"github.com/AERUMTechnology/go-aerum/common"
+)
+
+// Tests that the AERUM_* environment variables override the built-in Atmos
+// parameters.
+func TestLoadAtmosParamsFromEnv(t *testing.T) {
+	defer restoreAtmosParams()()
+
+	defer setenv(envAtmosNetID, "1234")()
+	defer setenv(envAtmosGovernanceAddress, "0x02c362540efc9FA5592621C9212D0bF776732050")()
+	defer setenv(envAtmosEthereumRPCProvider, "http://localhost:8545")()
+	defer setenv(envAtmosEpochInterval, "30")()
+
+	if err := LoadAtmosParamsFromEnv(); err != nil {
+		t.Fatalf("failed to load parameters: %v", err)
+	}
+	if id := NewAtmosNetID(); id != 1234 {
+		t.Errorf("network id mismatch: have %d, want %d", id, 1234)
+	}
+	if addr := NewAtmosGovernanceAddress(); addr != common.HexToAddress("0x02c362540efc9FA5592621C9212D0bF776732050") {
+		t.Errorf("governance address mismatch: have %x", addr)
+	}
+	if url := NewAtmosEthereumRPCProvider(); url != "http://localhost:8545" {
+		t.Errorf("rpc provider mismatch: have %s, want %s", url, "http://localhost:8545")
+	}
+	if epoch := NewAtmosEpochInterval(); epoch != 30 {
+		t.Errorf("epoch interval mismatch: have %d, want %d", epoch, 30)
+	}
+}
+
+// Tests that invalid AERUM_* environment variables are rejected without
+// touching any of the current parameters.
+func TestLoadAtmosParamsFromEnvInvalid(t *testing.T) {
+	defer restoreAtmosParams()()
+
+	tests := []struct {
+		name, value string
+	}{
+		{envAtmosNetID, "abc"},
+		{envAtmosNetID, "0"},
+		{envAtmosGovernanceAddress, "0x1234"},
+		{envAtmosEthereumRPCProvider, ""},
+		{envAtmosEpochInterval, "0"},
+		{envAtmosEpochInterval, "-5"},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer setenv(envAtmosNetID, "1234")()
+			defer setenv(tt.name, tt.value)()
+
+			if err := LoadAtmosParamsFromEnv(); err == nil {
+				t.Fatalf("test %d: invalid %s %q accepted", i, tt.name, tt.value)
+			}
+			if id := NewAtmosNetID(); id != 538 {
+				t.Errorf("test %d: network id overridden by invalid environment: have %d", i, id)
+			}
+		})
+	}
+}
+
+// Tests that a valid set of Atmos parameters can be swapped in and is served
+// by the getters.
+func TestSetAtmosParams(t *testing.T) {
+	defer restoreAtmosParams()()
+
+	p := GetAtmosParams()
+	p.MinDelegateNo = 2
+	p.NetID = 4321
+	p.GovernanceAddress = "0x02c362540efc9FA5592621C9212D0bF776732050"
+	p.BlockInterval = 1
+	p.EpochInterval = 10
+	p.BlockRewards = big.NewInt(1)
+
+	if err := SetAtmosParams(p); err != nil {
+		t.Fatalf("failed to set parameters: %v", err)
+	}
+	if n := NewAtmosMinDelegateNo(); n != 2 {
+		t.Errorf("minimum delegate count mismatch: have %d, want %d", n, 2)
+	}
+	if id := NewAtmosNetID(); id != 4321 {
+		t.Errorf("network id mismatch: have %d, want %d", id, 4321)
+	}
+	if addr := NewAtmosGovernanceAddress(); addr != common.HexToAddress("0x02c362540efc9FA5592621C9212D0bF776732050") {
+		t.Errorf("governance address mismatch: have %x", addr)
+	}
+	if period := NewAtmosBlockInterval(); period != 1 {
+		t.Errorf("block interval mismatch: have %d, want %d", period, 1)
+	}
+	if epoch := NewAtmosEpochInterval(); epoch != 10 {
+		t.Errorf("epoch interval mismatch: have %d, want %d", epoch, 10)
+	}
+	// Mutating the caller's reward must not leak into the package parameters
+	p.BlockRewards.SetInt64(2)
+	if reward := NewAtmosBlockRewards(); reward.Cmp(big.NewInt(1)) != 0 {
+		t.Errorf("block rewards mismatch: have %v, want %v", reward, 1)
+	}
+}
+
+// Tests that invalid Atmos parameters are rejected without touching any of the
+// current ones.
+func TestSetAtmosParamsInvalid(t *testing.T) {
+	defer restoreAtmosParams()()
+
+	tests := []func(p *AtmosParams){
+		func(p *AtmosParams) { p.MinDelegateNo = 1 },
+		func(p *AtmosParams) { p.NetID = 0 },
+		func(p *AtmosParams) { p.GovernanceAddress = "0x1234" },
+		func(p *AtmosParams) { p.TestGovernanceAddress = "not an address" },
+		func(p *AtmosParams) { p.BlockInterval = 0 },
+		func(p *AtmosParams) { p.EpochInterval = 0 },
+		func(p *AtmosParams) { p.EthereumRPCProvider = "" },
+		func(p *AtmosParams) { p.BlockRewards = nil },
+		func(p *AtmosParams) { p.BlockRewards = big.NewInt(-1) },
+	}
+	for i, tweak := range tests {
+		p := GetAtmosParams()
+		p.NetID = 1234
+		tweak(&p)
+
+		if err := SetAtmosParams(p); err == nil {
+			t.Errorf("test %d: invalid parameters accepted: %+v", i, p)
+		}
+		if id := NewAtmosNetID(); id != 538 {
+			t.Errorf("test %d: network id overridden by invalid parameters: have %d", i, id)
+		}
+	}
+}
+
+// restoreAtmosParams snapshots the package level Atmos parameters, returning a
+// function to reinstate them.
+func restoreAtmosParams() func() {
+	p := GetAtmosParams()
+	return func() {
+		if err := SetAtmosParams(p); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// setenv sets an environment variable, returning a function to restore its
+// previous value.
+func setenv(key, value string) func() {
+	prev, ok := os.LookupEnv(key)
+	os.Setenv(key, value)
+
+	return func() {
+		if ok {
+			os.Setenv(key, prev)
+		} else {
+			os.Unsetenv(key)
+		}
+	}
+}
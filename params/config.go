@@ -20,6 +20,7 @@ import (
 	"encoding/binary"
 	"fmt"
 	"math/big"
+	"time"
 
 	"github.com/AERUMTechnology/go-aerum/common"
 	"github.com/AERUMTechnology/go-aerum/crypto"
@@ -338,11 +339,49 @@ func (c *CliqueConfig) String() string {
 // Added by Aerum
 // AtmosConfig is the consensus engine configs for aerum proof-of-authority based sealing.
 type AtmosConfig struct {
-	Period                     uint64         `json:"period"`              // Number of seconds between blocks to enforce
-	Epoch                      uint64         `json:"epoch"`               // Epoch length to reset votes and checkpoint
-	GovernanceAddress          common.Address `json:"governanceAddress"`   // Governance contract AERUMTechnology address
-	EthereumApiEndpoint string        		  `json:"ethereumApiEndpoint"` // Aerum node API endpoint (ipc, http, etc)
-	EnableTestNet bool                        `json:"enableTestNet"`	   // Enable Atmos test net
+	Period                      uint64         `json:"period"`                                // Number of seconds between blocks to enforce
+	Epoch                       uint64         `json:"epoch"`                                 // Epoch length to reset votes and checkpoint
+	GovernanceAddress           common.Address `json:"governanceAddress"`                     // Governance contract AERUMTechnology address
+	EthereumApiEndpoint         string         `json:"ethereumApiEndpoint"`                   // Aerum node API endpoint (ipc, http, etc)
+	EthereumApiEndpoints        []string       `json:"ethereumApiEndpoints,omitempty"`        // Fallback endpoints tried in order after EthereumApiEndpoint
+	EnableTestNet               bool           `json:"enableTestNet"`                         // Enable Atmos test net
+	DevMode                     bool           `json:"devMode,omitempty"`                     // Acknowledge development mode, required to accept a zero period
+	Vanity                      []byte         `json:"vanity,omitempty"`                      // Vanity (at most 32 bytes) placed at the start of sealed blocks' extra-data
+	AllowLocalProposals         bool           `json:"allowLocalProposals,omitempty"`         // Cast the locally proposed signer votes into prepared blocks (advisory, never tallied)
+	GovernanceCallTimeout       time.Duration  `json:"governanceCallTimeout,omitempty"`       // Deadline for dialing and querying the governance contract
+	GovernanceRetries           int            `json:"governanceRetries,omitempty"`           // Number of retries for failed governance lookups (negative disables)
+	GovernanceLookbackSeconds   *int64         `json:"governanceLookbackSeconds,omitempty"`   // Seconds before the parent block to query governance at (nil = default, 0 = no offset)
+	ComposersCacheSize          int            `json:"composersCacheSize,omitempty"`          // Number of governance composer sets to keep in memory
+	SignersPerEpoch             int            `json:"signersPerEpoch,omitempty"`             // Maximum number of signers selected for an epoch
+	MinSigners                  int            `json:"minSigners,omitempty"`                  // Minimum number of signers a committee must consist of
+	EnforceRecentTimeout        bool           `json:"enforceRecentTimeout,omitempty"`        // Let recent signers seal after a timeout instead of rejecting them
+	RecentsTimeout              time.Duration  `json:"recentsTimeout,omitempty"`              // Timeout a recent signer must wait before sealing again
+	WiggleTime                  time.Duration  `json:"wiggleTime,omitempty"`                  // Random delay (per signer) to allow concurrent out-of-turn signers
+	BlockReward                 *big.Int       `json:"blockReward,omitempty"`                 // Block reward in wei credited to the signer (nil = network default)
+	RewardHalvingInterval       uint64         `json:"rewardHalvingInterval,omitempty"`       // Number of blocks after which the block reward halves (0 = constant)
+	RewardEpochBlocks           *bool          `json:"rewardEpochBlocks,omitempty"`           // Whether checkpoint blocks are rewarded too (nil = true)
+	AllowedFutureDrift          time.Duration  `json:"allowedFutureDrift,omitempty"`          // Tolerated clock skew for headers timestamped in the future
+	InTurnDifficulty            uint64         `json:"inTurnDifficulty,omitempty"`            // Block difficulty for in-turn signatures (0 = 2)
+	OutOfTurnDifficulty         uint64         `json:"outOfTurnDifficulty,omitempty"`         // Block difficulty for out-of-turn signatures (0 = 1)
+	GovernancePinnedBlock       *big.Int       `json:"governancePinnedBlock,omitempty"`       // Ethereum block to read the governance state at (nil = latest, by timestamp)
+	GovernanceConfirmations     uint64         `json:"governanceConfirmations,omitempty"`     // Ethereum blocks the governance lookup time must be buried under (0 = none)
+	MaxStatsSpan                uint64         `json:"maxStatsSpan,omitempty"`                // Maximum number of blocks signing statistics can be gathered over
+	StaticSigners               bool           `json:"staticSigners,omitempty"`               // Carry the genesis signers across epochs instead of loading them from governance
+	MinSignerBalance            *big.Int       `json:"minSignerBalance,omitempty"`            // Balance in wei a signer must hold to be rewarded (nil = no minimum)
+	GovernanceGracePeriodEpochs uint64         `json:"governanceGracePeriodEpochs,omitempty"` // Epochs to keep the last governance signers for if governance fails
+	BootstrapFastPeriod         uint64         `json:"bootstrapFastPeriod,omitempty"`         // Number of seconds between blocks during the bootstrap ramp
+	BootstrapFastBlocks         uint64         `json:"bootstrapFastBlocks,omitempty"`         // Number of initial blocks produced at the bootstrap period (0 = no ramp)
+	SignatureCacheSize          int            `json:"signatureCacheSize,omitempty"`          // Number of recovered block signers to keep in memory
+	SnapshotCacheSize           int            `json:"snapshotCacheSize,omitempty"`           // Number of recent vote snapshots to keep in memory
+	NoWiggle                    bool           `json:"noWiggle,omitempty"`                    // Seal out-of-turn blocks without the random wiggle delay (development only)
+	TreasuryAddress             common.Address `json:"treasuryAddress,omitempty"`             // Address receiving the treasury cut of the block rewards
+	TreasuryRewardBps           uint64         `json:"treasuryRewardBps,omitempty"`           // Share of the block reward in basis points credited to the treasury (0 = none)
+	EnforceCoinbaseIsSigner     bool           `json:"enforceCoinbaseIsSigner,omitempty"`     // Require non-checkpoint blocks to name their signer as the beneficiary
+	AllowEmptyBlocks            bool           `json:"allowEmptyBlocks,omitempty"`            // Keep sealing empty blocks on zero-period chains instead of pausing
+	SnapshotWalkWarnDepth       uint64         `json:"snapshotWalkWarnDepth,omitempty"`       // Number of headers a snapshot lookup may walk back before warning (0 = 1000)
+	StrictRulesBlock            *big.Int       `json:"strictRulesBlock,omitempty"`            // Block from which the stricter checkpoint, period and recents rules apply (nil = never)
+
+	TrustedCheckpoints map[uint64][]common.Address `json:"trustedCheckpoints,omitempty"` // Signers of epochs (keyed by epoch index) trusted instead of querying governance
 }
 
 // Added by Aerum
@@ -351,6 +390,12 @@ func (c *AtmosConfig) String() string {
 	return "atmos"
 }
 
+// Added by Aerum
+// IsStrictRules returns whether num is either equal to the strict rules block or greater.
+func (c *AtmosConfig) IsStrictRules(num *big.Int) bool {
+	return isForked(c.StrictRulesBlock, num)
+}
+
 // String implements the fmt.Stringer interface.
 func (c *ChainConfig) String() string {
 	var engine interface{}